@@ -0,0 +1,602 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* Key of the transient map entry carrying the clinical details of an adverse event report */
+const ADVERSE_EVENT_TRANSIENT_KEY = "adverseEvent"
+
+/* Private data collection restricted to the pharmacovigilance teams */
+const ADVERSE_EVENT_COLLECTION = "adverseEventCollection"
+
+/*
+AdverseEventReport holds an adverse event following immunization. It is only stored in the
+adverse event collection, while the public ledger only carries the signal count of the batch.
+*/
+type AdverseEventReport struct {
+	Id             string `json:"id"`
+	PacketId       string `json:"packetId"`
+	ProductId      string `json:"productId"`
+	ManufacturerId string `json:"manufacturerId"`
+	BatchId        string `json:"batchId"`
+	LotNumber      string `json:"lotNumber"`
+	Severity       string `json:"severity"`
+	PatientRef     string `json:"patientRef,omitempty"`
+	OnsetDate      int64  `json:"onsetDate"`
+	Description    string `json:"description"`
+	Outcome        string `json:"outcome,omitempty"`
+	ReportDate     int64  `json:"reportDate"`
+	ReportedBy     string `json:"reportedBy"`
+	DocType        string `json:"docType"`
+}
+
+type AdverseEventSignal struct {
+	Id              string `json:"id"`
+	BatchId         string `json:"batchId"`
+	ManufacturerId  string `json:"manufacturerId"`
+	ProductId       string `json:"productId"`
+	LotNumber       string `json:"lotNumber"`
+	Count           int    `json:"count"`
+	SeriousCount    int    `json:"seriousCount"`
+	ReviewedCount   int    `json:"reviewedCount"`
+	LastReportDate  int64  `json:"lastReportDate"`
+	AutoHoldApplied bool   `json:"autoHoldApplied"`
+	DocType         string `json:"docType"`
+}
+
+/*
+AdverseEventPacket marks a packet already counted in the signal of its batch, so that further reports
+against the packet do not raise the count again.
+*/
+type AdverseEventPacket struct {
+	Id      string `json:"id"`
+	BatchId string `json:"batchId"`
+	Serious bool   `json:"serious"`
+	DocType string `json:"docType"`
+}
+
+type AdverseEventConfig struct {
+	Id        string `json:"id"`
+	Threshold int    `json:"threshold"`
+	UpdatedBy string `json:"updatedBy"`
+	DocType   string `json:"docType"`
+}
+
+type BatchHoldDecision struct {
+	Id             string `json:"id"`
+	BatchId        string `json:"batchId"`
+	ManufacturerId string `json:"manufacturerId"`
+	Decision       string `json:"decision"`
+	Remarks        string `json:"remarks,omitempty"`
+	DecisionDate   int64  `json:"decisionDate"`
+	SignalCount    int    `json:"signalCount"`
+	RegulatorId    string `json:"regulatorId"`
+	DocType        string `json:"docType"`
+}
+
+type AdverseEventAlert struct {
+	ReportId       string `json:"reportId"`
+	ManufacturerId string `json:"manufacturerId"`
+	ProductId      string `json:"productId"`
+	BatchId        string `json:"batchId"`
+	LotNumber      string `json:"lotNumber"`
+	Severity       string `json:"severity"`
+	SignalCount    int    `json:"signalCount"`
+	BatchOnHold    bool   `json:"batchOnHold"`
+}
+
+/*
+ReportAdverseEvent files an adverse event following immunization against a packet. It is called by the Regulator,
+or by the Chemist, Hospital or Clinic that holds the packet, sold it or administered it. The packet is resolved to its
+batch and manufacturer, the clinical details passed through the transient map under the key "adverseEvent" are stored
+in the adverse event collection, and the signal count of the batch is incremented once per packet. Once the signals not yet reviewed by the Regulator reach the configured threshold, the batch
+is automatically put on hold. The manufacturer is notified through the "Adverse Event Alert" event.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param reportInputString: JSON string with the packet and the report date
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) ReportAdverseEvent(ctx contractapi.TransactionContextInterface, reportInputString string) error {
+	reportInput := struct {
+		PacketId   string `json:"packetId" validate:"required"`
+		ReportDate int64  `json:"reportDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(reportInputString), &reportInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for adverse event report: %v", err.Error())
+	}
+	fmt.Println("Input String:", reportInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(reportInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	reporterDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is allowed to report adverse events */
+	if !isDispensingRole(role) && role != REGULATOR {
+		return fmt.Errorf("Only Chemists, Hospitals, Clinics and Regulators are allowed to report adverse events")
+	}
+
+	/* Reads the clinical details of the report from the transient map */
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("Failed to get transient data: %v", err.Error())
+	}
+	detailsBytes, ok := transientMap[ADVERSE_EVENT_TRANSIENT_KEY]
+	if !ok {
+		return fmt.Errorf("Adverse event details must be passed in the transient map under the key %v", ADVERSE_EVENT_TRANSIENT_KEY)
+	}
+
+	detailsInput := struct {
+		Severity    string `json:"severity" validate:"required,oneof=MILD MODERATE SEVERE FATAL"`
+		PatientRef  string `json:"patientRef"`
+		OnsetDate   int64  `json:"onsetDate" validate:"required"`
+		Description string `json:"description" validate:"required"`
+		Outcome     string `json:"outcome"`
+	}{}
+	err = json.Unmarshal(detailsBytes, &detailsInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the transient adverse event details: %v", err.Error())
+	}
+	err = validateInputParams(detailsInput)
+	if err != nil {
+		return err
+	}
+
+	/* Resolves the packet to its batch and manufacturer */
+	asset, err := getAsset(ctx, reportInput.PacketId)
+	if err != nil {
+		return err
+	}
+
+	/* Checks that a chemist, hospital or clinic has dealt with the packet */
+	if role != REGULATOR {
+		handled, err := hasHandledPacket(ctx, reporterDetails.Id, asset)
+		if err != nil {
+			return err
+		}
+		if !handled {
+			return fmt.Errorf("Packet %v was never held, sold or administered by %v", asset.Id, reporterDetails.Id)
+		}
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	report := AdverseEventReport{
+		Id:             txID,
+		PacketId:       asset.Id,
+		ProductId:      asset.ProductId,
+		ManufacturerId: asset.ManufacturerId,
+		BatchId:        asset.BatchId,
+		LotNumber:      asset.LotNumber,
+		Severity:       detailsInput.Severity,
+		PatientRef:     detailsInput.PatientRef,
+		OnsetDate:      detailsInput.OnsetDate,
+		Description:    detailsInput.Description,
+		Outcome:        detailsInput.Outcome,
+		ReportDate:     reportInput.ReportDate,
+		ReportedBy:     reporterDetails.Id,
+		DocType:        ADVERSE_EVENT,
+	}
+
+	/* Inserts the report into the adverse event collection */
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("Failed to marshal adverse event report: %v", err.Error())
+	}
+	err = ctx.GetStub().PutPrivateData(ADVERSE_EVENT_COLLECTION, report.Id, reportJSON)
+	if err != nil {
+		return fmt.Errorf("Failed to insert adverse event report: %v", err.Error())
+	}
+
+	/* Increments the signal count of the batch */
+	signal, err := getAdverseEventSignal(ctx, asset.BatchId)
+	if err != nil {
+		return err
+	}
+	if signal.Id == "" {
+		signal = AdverseEventSignal{
+			Id:             asset.BatchId,
+			BatchId:        asset.BatchId,
+			ManufacturerId: asset.ManufacturerId,
+			ProductId:      asset.ProductId,
+			LotNumber:      asset.LotNumber,
+			DocType:        ADVERSE_EVENT_SIGNAL,
+		}
+	}
+
+	/* Counts each packet at most once, along with whether any of its reports is serious */
+	serious := detailsInput.Severity == "SEVERE" || detailsInput.Severity == "FATAL"
+	packetBytes, err := vaccinechainhelper.IsExist(ctx, asset.Id, ADVERSE_EVENT_PACKET)
+	if err != nil {
+		return err
+	}
+	counted := AdverseEventPacket{Id: asset.Id, BatchId: asset.BatchId, DocType: ADVERSE_EVENT_PACKET}
+	if packetBytes != nil {
+		err = json.Unmarshal(packetBytes, &counted)
+		if err != nil {
+			return fmt.Errorf("Failed to convert adverse event packet: %v", err.Error())
+		}
+	} else {
+		signal.Count++
+	}
+	if serious && !counted.Serious {
+		signal.SeriousCount++
+		counted.Serious = true
+	}
+	err = insertData(ctx, counted, asset.Id, ADVERSE_EVENT_PACKET)
+	if err != nil {
+		return err
+	}
+	if reportInput.ReportDate > signal.LastReportDate {
+		signal.LastReportDate = reportInput.ReportDate
+	}
+
+	/* Puts the batch on hold once the unreviewed signals reach the configured threshold */
+	config, err := getAdverseEventConfig(ctx)
+	if err != nil {
+		return err
+	}
+	batchDetails, err := getBatch(ctx, asset.ManufacturerId, asset.BatchId)
+	if err != nil {
+		return err
+	}
+	if config.Threshold > 0 && signal.Count-signal.ReviewedCount >= config.Threshold &&
+		batchDetails.ReleaseStatus != ReleaseStatuses.OnHold && batchDetails.ReleaseStatus != ReleaseStatuses.Rejected {
+		batchDetails.PreHoldStatus = batchDetails.ReleaseStatus
+		batchDetails.ReleaseStatus = ReleaseStatuses.OnHold
+		err = insertData(ctx, batchDetails, asset.ManufacturerId, asset.BatchId)
+		if err != nil {
+			return err
+		}
+		signal.AutoHoldApplied = true
+	}
+
+	err = insertData(ctx, signal, signal.Id, ADVERSE_EVENT_SIGNAL)
+	if err != nil {
+		return err
+	}
+
+	/* Notifies the manufacturer without disclosing any clinical or patient details */
+	alert := AdverseEventAlert{
+		ReportId:       report.Id,
+		ManufacturerId: report.ManufacturerId,
+		ProductId:      report.ProductId,
+		BatchId:        report.BatchId,
+		LotNumber:      report.LotNumber,
+		Severity:       report.Severity,
+		SignalCount:    signal.Count,
+		BatchOnHold:    batchDetails.ReleaseStatus == ReleaseStatuses.OnHold,
+	}
+	alertJSON, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().SetEvent("Adverse Event Alert", alertJSON)
+	if err != nil {
+		return fmt.Errorf("failed to setEvent Adverse Event Alert: %v", err.Error())
+	}
+
+	fmt.Println("********** End of Report Adverse Event Function ******************")
+	return nil
+}
+
+/*
+SetAdverseEventThreshold sets the number of unreviewed adverse event signals after which a batch is
+automatically put on hold. A threshold of zero disables the automatic hold.
+It is called by the Vaccine Chain Admin or the Regulator.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param threshold: Number of signals triggering the automatic hold
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) SetAdverseEventThreshold(ctx contractapi.TransactionContextInterface, threshold int) error {
+	if threshold < 0 {
+		return fmt.Errorf("Threshold cannot be negative")
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is allowed to configure the threshold */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN && role != REGULATOR {
+		return fmt.Errorf("Only the Vaccine Chain Admin and the Regulator are allowed to set the adverse event threshold")
+	}
+
+	config := AdverseEventConfig{
+		Id:        ADVERSE_EVENT_SIGNAL,
+		Threshold: threshold,
+		UpdatedBy: entityDetails.Id,
+		DocType:   CONFIG,
+	}
+	err = insertData(ctx, config, config.Id, CONFIG)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Set Adverse Event Threshold Function ******************")
+	return nil
+}
+
+/*
+ReviewBatchHold records the decision of the Regulator on a batch put on hold after adverse event signals.
+The batch is either released from the hold, returning to the release status it had before, or rejected, and the
+signals counted so far are marked as reviewed. A batch held before its regulatory release goes back to pending release.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param reviewInputString: JSON string with the batch and the decision
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) ReviewBatchHold(ctx contractapi.TransactionContextInterface, reviewInputString string) error {
+	reviewInput := struct {
+		ManufacturerId string `json:"manufacturerId" validate:"required"`
+		BatchId        string `json:"batchId" validate:"required"`
+		Decision       string `json:"decision" validate:"required,oneof=RELEASED REJECTED"`
+		Remarks        string `json:"remarks"`
+		DecisionDate   int64  `json:"decisionDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(reviewInputString), &reviewInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for batch hold review: %v", err.Error())
+	}
+	fmt.Println("Input String:", reviewInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(reviewInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	regulatorDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is that of a regulator */
+	if role != REGULATOR {
+		return fmt.Errorf("Only the Regulator is allowed to review a batch hold")
+	}
+
+	batchDetails, err := getBatch(ctx, reviewInput.ManufacturerId, reviewInput.BatchId)
+	if err != nil {
+		return err
+	}
+	if batchDetails.ReleaseStatus != ReleaseStatuses.OnHold {
+		return fmt.Errorf("Batch %v is not on hold", reviewInput.BatchId)
+	}
+
+	signal, err := getAdverseEventSignal(ctx, reviewInput.BatchId)
+	if err != nil {
+		return err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	decision := BatchHoldDecision{
+		Id:             txID,
+		BatchId:        reviewInput.BatchId,
+		ManufacturerId: reviewInput.ManufacturerId,
+		Decision:       reviewInput.Decision,
+		Remarks:        reviewInput.Remarks,
+		DecisionDate:   reviewInput.DecisionDate,
+		SignalCount:    signal.Count,
+		RegulatorId:    regulatorDetails.Id,
+		DocType:        BATCH_HOLD_DECISION,
+	}
+	err = insertData(ctx, decision, txID, "")
+	if err != nil {
+		return err
+	}
+
+	/* Updates the release status of the batch */
+	if reviewInput.Decision == "RELEASED" {
+		batchDetails.ReleaseStatus = batchDetails.PreHoldStatus
+		if batchDetails.ReleaseStatus == "" {
+			/* Batches held before the pre-hold status was kept fall back on their release decision */
+			batchDetails.ReleaseStatus, err = getRecordedReleaseStatus(ctx, reviewInput.BatchId)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		batchDetails.ReleaseStatus = ReleaseStatuses.Rejected
+	}
+	batchDetails.PreHoldStatus = ""
+	err = insertData(ctx, batchDetails, reviewInput.ManufacturerId, reviewInput.BatchId)
+	if err != nil {
+		return err
+	}
+
+	/* Marks the signals counted so far as reviewed */
+	if signal.Id != "" {
+		signal.ReviewedCount = signal.Count
+		signal.AutoHoldApplied = false
+		err = insertData(ctx, signal, signal.Id, ADVERSE_EVENT_SIGNAL)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("********** End of Review Batch Hold Function ******************")
+	return nil
+}
+
+/*
+ViewAdverseEventSignal retrieves the adverse event signal count of a batch. It is called by the manufacturer
+of the batch, the Vaccine Chain Admin or the Regulator.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param batchId: ID of the batch
+
+@returns string: Returns the JSON-encoded signal count
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) ViewAdverseEventSignal(ctx contractapi.TransactionContextInterface, batchId string) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	signal, err := getAdverseEventSignal(ctx, batchId)
+	if err != nil {
+		return "", err
+	}
+	if signal.Id == "" {
+		return "", fmt.Errorf("No adverse event signals recorded for batch with ID: %v", batchId)
+	}
+
+	/* Checks if the user is allowed to view the signals of the batch */
+	if !(role == vaccinechainhelper.MANUFACTURER && signal.ManufacturerId == entityDetails.Id) &&
+		role != vaccinechainhelper.VACCINE_CHAIN_ADMIN && role != REGULATOR {
+		return "", fmt.Errorf("You are not authorized to view the adverse event signals of batch %v", batchId)
+	}
+
+	signalJSON, err := json.Marshal(signal)
+	if err != nil {
+		return "", err
+	}
+	return string(signalJSON), nil
+}
+
+/*
+ViewAdverseEventReport retrieves an adverse event report from the adverse event collection.
+It is exclusively called by the Regulator, from a peer of an organization that is a member of the collection.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param reportId: ID of the report
+
+@returns string: Returns the JSON-encoded adverse event report
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) ViewAdverseEventReport(ctx contractapi.TransactionContextInterface, reportId string) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	_, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is that of a regulator */
+	if role != REGULATOR {
+		return "", fmt.Errorf("Only the Regulator is allowed to view adverse event reports")
+	}
+
+	reportBytes, err := ctx.GetStub().GetPrivateData(ADVERSE_EVENT_COLLECTION, reportId)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get adverse event report %v: %v", reportId, err.Error())
+	}
+	if reportBytes == nil {
+		return "", fmt.Errorf("Record does not exist with ID: %v", reportId)
+	}
+
+	return string(reportBytes), nil
+}
+
+/* getAdverseEventSignal returns the signal count of a batch, or an empty signal if none was reported yet */
+func getAdverseEventSignal(ctx contractapi.TransactionContextInterface, batchId string) (AdverseEventSignal, error) {
+	signalBytes, err := vaccinechainhelper.IsExist(ctx, batchId, ADVERSE_EVENT_SIGNAL)
+	if err != nil {
+		return AdverseEventSignal{}, err
+	}
+	if signalBytes == nil {
+		return AdverseEventSignal{}, nil
+	}
+
+	var signal AdverseEventSignal
+	err = json.Unmarshal(signalBytes, &signal)
+	if err != nil {
+		return AdverseEventSignal{}, fmt.Errorf("Failed to convert adverse event signal: %v", err.Error())
+	}
+	return signal, nil
+}
+
+/*
+hasHandledPacket checks whether an entity holds a packet, sold it on a receipt, on its own or within its carton,
+or administered it.
+*/
+func hasHandledPacket(ctx contractapi.TransactionContextInterface, entityId string, asset Asset) (bool, error) {
+	if asset.Owner == entityId {
+		return true, nil
+	}
+
+	bundleIds := []string{asset.Id}
+	if asset.CartonId != "" {
+		bundleIds = append(bundleIds, asset.CartonId)
+	}
+	sold, err := hasQueryResult(ctx, map[string]interface{}{
+		"docType":    vaccinechainhelper.RECEIPT,
+		"supplierId": entityId,
+		"bundleId":   map[string]interface{}{"$in": bundleIds},
+	})
+	if err != nil || sold {
+		return sold, err
+	}
+
+	return hasQueryResult(ctx, map[string]interface{}{
+		"docType":        VACCINATION_RECORD,
+		"packetId":       asset.Id,
+		"administeredBy": entityId,
+	})
+}
+
+/* hasQueryResult checks whether any record matches the selector */
+func hasQueryResult(ctx contractapi.TransactionContextInterface, selector map[string]interface{}) (bool, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return false, err
+	}
+	fmt.Println("queryString:", string(queryBytes))
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(string(queryBytes))
+	if err != nil {
+		return false, err
+	}
+	defer resultsIterator.Close()
+
+	return resultsIterator.HasNext(), nil
+}
+
+/* getAdverseEventConfig returns the adverse event configuration, with the automatic hold disabled if never set */
+func getAdverseEventConfig(ctx contractapi.TransactionContextInterface) (AdverseEventConfig, error) {
+	configBytes, err := vaccinechainhelper.IsExist(ctx, ADVERSE_EVENT_SIGNAL, CONFIG)
+	if err != nil {
+		return AdverseEventConfig{}, err
+	}
+	if configBytes == nil {
+		return AdverseEventConfig{}, nil
+	}
+
+	var config AdverseEventConfig
+	err = json.Unmarshal(configBytes, &config)
+	if err != nil {
+		return AdverseEventConfig{}, fmt.Errorf("Failed to convert adverse event configuration: %v", err.Error())
+	}
+	return config, nil
+}
@@ -0,0 +1,301 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Allocation caps the number of packets of a product that can be shipped to a customer during a period.
+*/
+type Allocation struct {
+	Id             string `json:"id"`
+	CustomerId     string `json:"customerId"`
+	ProductId      string `json:"productId"`
+	ManufacturerId string `json:"manufacturerId"`
+	PeriodStart    int64  `json:"periodStart"`
+	PeriodEnd      int64  `json:"periodEnd"`
+	MaxQuantity    int    `json:"maxQuantity"`
+	UsedQuantity   int    `json:"usedQuantity"`
+	SetBy          string `json:"setBy"`
+	DocType        string `json:"docType"`
+}
+
+type AllocationUtilisation struct {
+	AllocationId       string  `json:"allocationId"`
+	CustomerId         string  `json:"customerId"`
+	ProductId          string  `json:"productId"`
+	ManufacturerId     string  `json:"manufacturerId"`
+	PeriodStart        int64   `json:"periodStart"`
+	PeriodEnd          int64   `json:"periodEnd"`
+	MaxQuantity        int     `json:"maxQuantity"`
+	UsedQuantity       int     `json:"usedQuantity"`
+	RemainingQuantity  int     `json:"remainingQuantity"`
+	UtilisationPercent float64 `json:"utilisationPercent"`
+}
+
+/*
+SetAllocation sets the maximum number of packets of a product that can be shipped to a customer during a period.
+An existing allocation can be resized, but not below the packets already shipped against it. Allocations of the same
+product for the same customer cannot overlap. It is called by the Vaccine Chain Admin or the Regulator.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param allocationInputString: JSON string with the allocation details
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) SetAllocation(ctx contractapi.TransactionContextInterface, allocationInputString string) error {
+	allocationInput := struct {
+		Id             string `json:"id" validate:"required"`
+		CustomerId     string `json:"customerId" validate:"required"`
+		ProductId      string `json:"productId" validate:"required"`
+		ManufacturerId string `json:"manufacturerId" validate:"required"`
+		PeriodStart    int64  `json:"periodStart" validate:"required"`
+		PeriodEnd      int64  `json:"periodEnd" validate:"required,gtfield=PeriodStart"`
+		MaxQuantity    int    `json:"maxQuantity" validate:"required,gt=0"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(allocationInputString), &allocationInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for allocation: %v", err.Error())
+	}
+	fmt.Println("Input String:", allocationInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(allocationInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is allowed to set allocations */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN && role != REGULATOR {
+		return fmt.Errorf("Only the Vaccine Chain Admin and the Regulator are allowed to set allocations")
+	}
+
+	/* Checks if the product and the customer exist */
+	_, err = getProduct(ctx, allocationInput.ProductId, allocationInput.ManufacturerId)
+	if err != nil {
+		return err
+	}
+	_, _, err = getActiveEntity(ctx, allocationInput.CustomerId, vaccinechainhelper.DISTRIBUTER, vaccinechainhelper.CHEMIST, HOSPITAL, CLINIC)
+	if err != nil {
+		return err
+	}
+
+	allocation := Allocation{
+		Id:             allocationInput.Id,
+		CustomerId:     allocationInput.CustomerId,
+		ProductId:      allocationInput.ProductId,
+		ManufacturerId: allocationInput.ManufacturerId,
+		DocType:        ALLOCATION,
+	}
+
+	/* An existing allocation keeps its customer, product and the packets already shipped against it */
+	allocationBytes, err := vaccinechainhelper.IsExist(ctx, allocationInput.Id, ALLOCATION)
+	if err != nil {
+		return err
+	}
+	if allocationBytes != nil {
+		var existing Allocation
+		err = json.Unmarshal(allocationBytes, &existing)
+		if err != nil {
+			return fmt.Errorf("Failed to convert allocation details: %v", err.Error())
+		}
+		if existing.CustomerId != allocation.CustomerId || existing.ProductId != allocation.ProductId ||
+			existing.ManufacturerId != allocation.ManufacturerId {
+			return fmt.Errorf("Allocation %v was set for another customer or product", allocationInput.Id)
+		}
+		if allocationInput.MaxQuantity < existing.UsedQuantity {
+			return fmt.Errorf("Allocation %v cannot be set below the %v packets already shipped", allocationInput.Id, existing.UsedQuantity)
+		}
+		allocation.UsedQuantity = existing.UsedQuantity
+	}
+
+	/* Checks that the period does not overlap another allocation of the product for the customer */
+	overlapping, err := getAllocations(ctx, allocation.CustomerId, allocation.ProductId, allocation.ManufacturerId,
+		allocationInput.PeriodEnd, allocationInput.PeriodStart)
+	if err != nil {
+		return err
+	}
+	for _, other := range overlapping {
+		if other.Id != allocation.Id {
+			return fmt.Errorf("Allocation period overlaps allocation %v", other.Id)
+		}
+	}
+
+	allocation.PeriodStart = allocationInput.PeriodStart
+	allocation.PeriodEnd = allocationInput.PeriodEnd
+	allocation.MaxQuantity = allocationInput.MaxQuantity
+	allocation.SetBy = entityDetails.Id
+
+	/* Inserts the allocation into the ledger */
+	err = insertData(ctx, allocation, allocation.Id, ALLOCATION)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Set Allocation Function ******************")
+	return nil
+}
+
+/*
+GetAllocationUtilisation reports the packets shipped against each allocation of a customer. The Vaccine Chain Admin
+and the Regulator can report on any customer, or on all customers with an empty customer ID. Other entities get
+the report of their own allocations.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param customerId: ID of the customer
+
+@returns string: Returns the JSON-encoded utilisation of the allocations
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetAllocationUtilisation(ctx contractapi.TransactionContextInterface, customerId string) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Entities other than the admin and the regulator only see their own allocations */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN && role != REGULATOR {
+		customerId = entityDetails.Id
+	}
+
+	allocations, err := getAllocations(ctx, customerId, "", "", 0, 0)
+	if err != nil {
+		return "", err
+	}
+
+	utilisation := []AllocationUtilisation{}
+	for _, allocation := range allocations {
+		utilisation = append(utilisation, AllocationUtilisation{
+			AllocationId:       allocation.Id,
+			CustomerId:         allocation.CustomerId,
+			ProductId:          allocation.ProductId,
+			ManufacturerId:     allocation.ManufacturerId,
+			PeriodStart:        allocation.PeriodStart,
+			PeriodEnd:          allocation.PeriodEnd,
+			MaxQuantity:        allocation.MaxQuantity,
+			UsedQuantity:       allocation.UsedQuantity,
+			RemainingQuantity:  allocation.MaxQuantity - allocation.UsedQuantity,
+			UtilisationPercent: float64(allocation.UsedQuantity) * 100 / float64(allocation.MaxQuantity),
+		})
+	}
+
+	utilisationJSON, err := json.Marshal(utilisation)
+	if err != nil {
+		return "", err
+	}
+	return string(utilisationJSON), nil
+}
+
+/*
+consumeAllocation draws the shipped packets from the allocation of the product covering the transaction time for the
+customer, and refuses the shipment if the allocation would be exceeded. Shipments of products without an allocation
+for the customer are not restricted. The allocation found by the query is read again by key, so that concurrent
+shipments against it conflict at commit instead of both drawing from the same quantity.
+*/
+func consumeAllocation(ctx contractapi.TransactionContextInterface, customerId string, productId string, manufacturerId string,
+	quantity int16) error {
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	shipmentDate := timestamp.Unix()
+
+	allocations, err := getAllocations(ctx, customerId, productId, manufacturerId, shipmentDate, shipmentDate)
+	if err != nil {
+		return err
+	}
+	if len(allocations) == 0 {
+		return nil
+	}
+
+	/* Rich query reads are not checked at commit, so the allocation is read again by key */
+	allocationBytes, err := vaccinechainhelper.IsExist(ctx, allocations[0].Id, ALLOCATION)
+	if err != nil {
+		return err
+	}
+	if allocationBytes == nil {
+		return fmt.Errorf("Record does not exist with ID: %v", allocations[0].Id)
+	}
+
+	var allocation Allocation
+	err = json.Unmarshal(allocationBytes, &allocation)
+	if err != nil {
+		return fmt.Errorf("Failed to convert allocation details: %v", err.Error())
+	}
+	if allocation.UsedQuantity+int(quantity) > allocation.MaxQuantity {
+		return fmt.Errorf("Shipment of %v packets exceeds allocation %v: %v of %v packets remaining",
+			quantity, allocation.Id, allocation.MaxQuantity-allocation.UsedQuantity, allocation.MaxQuantity)
+	}
+
+	allocation.UsedQuantity += int(quantity)
+	return insertData(ctx, allocation, allocation.Id, ALLOCATION)
+}
+
+/*
+getAllocations returns the allocations of a customer, optionally narrowed to a product and to the periods starting
+on or before startsBy and ending on or after endsFrom.
+*/
+func getAllocations(ctx contractapi.TransactionContextInterface, customerId string, productId string, manufacturerId string,
+	startsBy int64, endsFrom int64) ([]Allocation, error) {
+	selector := map[string]interface{}{
+		"docType": ALLOCATION,
+	}
+	if customerId != "" {
+		selector["customerId"] = customerId
+	}
+	if productId != "" {
+		selector["productId"] = productId
+		selector["manufacturerId"] = manufacturerId
+	}
+	if startsBy != 0 {
+		selector["periodStart"] = map[string]interface{}{"$lte": startsBy}
+	}
+	if endsFrom != 0 {
+		selector["periodEnd"] = map[string]interface{}{"$gte": endsFrom}
+	}
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("queryString:", string(queryBytes))
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	allocations := []Allocation{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var allocation Allocation
+		err = json.Unmarshal(queryResult.Value, &allocation)
+		if err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, allocation)
+	}
+	return allocations, nil
+}
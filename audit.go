@@ -0,0 +1,285 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type AuditLog struct {
+	Id              string    `json:"id"`
+	AuditorId       string    `json:"auditorId"`
+	AuditorIdentity string    `json:"auditorIdentity"`
+	Query           string    `json:"query"`
+	TargetId        string    `json:"targetId"`
+	Timestamp       time.Time `json:"timestamp"`
+	DocType         string    `json:"docType"`
+}
+
+/* Period during which a logged audit query can be run */
+const AUDIT_LOG_VALIDITY = time.Hour
+
+/* Audit queries that can be logged with LogAuditQuery */
+var auditQueries = []string{
+	"AuditAssetsByEntity",
+	"AuditProductsByManufacturer",
+	"AuditReceiptsByEntity",
+	"AuditViewReceipt",
+}
+
+/*
+LogAuditQuery records on the ledger an audit query the Auditor is about to run, and returns the ID of the log to pass
+to the query. It must be submitted as a transaction: the audit queries refuse to run without a committed log, so that
+every query they answer is logged even though they are only evaluated. A log can be used for an hour.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param query: Name of the audit query, e.g. AuditAssetsByEntity
+@param targetId: ID of the entity or receipt the query is run on
+
+@returns string: Returns the ID of the audit log
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) LogAuditQuery(ctx contractapi.TransactionContextInterface, query string, targetId string) (string, error) {
+	if targetId == "" {
+		return "", fmt.Errorf("Target ID of the audit query is required")
+	}
+	knownQuery := false
+	for _, auditQuery := range auditQueries {
+		if query == auditQuery {
+			knownQuery = true
+		}
+	}
+	if !knownQuery {
+		return "", fmt.Errorf("Unknown audit query %v", query)
+	}
+
+	/* Validates the logged-in auditor */
+	auditorDetails, auditorIdentity, err := getAuditor(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	auditLog := AuditLog{
+		Id:              txID,
+		AuditorId:       auditorDetails.Id,
+		AuditorIdentity: auditorIdentity,
+		Query:           query,
+		TargetId:        targetId,
+		Timestamp:       timestamp,
+		DocType:         AUDIT_LOG,
+	}
+
+	/* Inserts the audit log into the ledger */
+	err = insertData(ctx, auditLog, txID, "")
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("********** End of Log Audit Query Function ******************")
+	return txID, nil
+}
+
+/*
+AuditAssetsByEntity retrieves all assets held by any entity. It is exclusively called by the Auditor.
+The query must first be logged on the ledger with LogAuditQuery.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param auditLogId: ID of the audit log returned by LogAuditQuery
+@param entityId: ID of the entity whose assets are audited
+
+@returns string: List of assets held by the entity
+@returns error: Returns an error if any validation fails or if there is an issue while interacting with the ledger.
+*/
+func (s *SmartContract) AuditAssetsByEntity(ctx contractapi.TransactionContextInterface, auditLogId string, entityId string) (string, error) {
+
+	/* Validates the logged-in auditor and the log of the query */
+	err := checkAuditLog(ctx, auditLogId, "AuditAssetsByEntity", entityId)
+	if err != nil {
+		return "", err
+	}
+
+	/* Retrieves the list of assets held by the entity */
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": map[string]interface{}{
+		"owner":   entityId,
+		"docType": vaccinechainhelper.ASSET,
+	}})
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("queryString: ", string(queryBytes))
+
+	return getQueryResultForQueryString(ctx, string(queryBytes))
+}
+
+/*
+AuditProductsByManufacturer retrieves all products listed by any manufacturer. It is exclusively called by the Auditor.
+The query must first be logged on the ledger with LogAuditQuery.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param auditLogId: ID of the audit log returned by LogAuditQuery
+@param manufacturerId: ID of the manufacturer whose products are audited
+
+@returns string: List of products created by the manufacturer
+@returns error: Returns an error if any validation fails or if there is an issue while interacting with the ledger.
+*/
+func (s *SmartContract) AuditProductsByManufacturer(ctx contractapi.TransactionContextInterface, auditLogId string, manufacturerId string) (string, error) {
+
+	/* Validates the logged-in auditor and the log of the query */
+	err := checkAuditLog(ctx, auditLogId, "AuditProductsByManufacturer", manufacturerId)
+	if err != nil {
+		return "", err
+	}
+
+	/* Retrieves the list of products created by the manufacturer */
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": map[string]interface{}{
+		"owner":   manufacturerId,
+		"docType": vaccinechainhelper.ITEM,
+	}})
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("queryString: ", string(queryBytes))
+
+	return getQueryResultForQueryString(ctx, string(queryBytes))
+}
+
+/*
+AuditReceiptsByEntity retrieves all receipts where any entity is either the supplier or the customer.
+It is exclusively called by the Auditor. The query must first be logged on the ledger with LogAuditQuery.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param auditLogId: ID of the audit log returned by LogAuditQuery
+@param entityId: ID of the entity whose receipts are audited
+
+@returns string: List of receipts involving the entity
+@returns error: Returns an error if any validation fails or if there is an issue while interacting with the ledger.
+*/
+func (s *SmartContract) AuditReceiptsByEntity(ctx contractapi.TransactionContextInterface, auditLogId string, entityId string) (string, error) {
+
+	/* Validates the logged-in auditor and the log of the query */
+	err := checkAuditLog(ctx, auditLogId, "AuditReceiptsByEntity", entityId)
+	if err != nil {
+		return "", err
+	}
+
+	/* Retrieves the list of receipts involving the entity */
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": map[string]interface{}{
+		"docType": vaccinechainhelper.RECEIPT,
+		"$or": []map[string]interface{}{
+			{"supplierId": entityId},
+			{"customerId": entityId},
+		},
+	}})
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("queryString: ", string(queryBytes))
+
+	return getQueryResultForQueryString(ctx, string(queryBytes))
+}
+
+/*
+AuditViewReceipt retrieves the entire details of any receipt transaction, along with its amendment chain.
+It is exclusively called by the Auditor.
+The query must first be logged on the ledger with LogAuditQuery.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param auditLogId: ID of the audit log returned by LogAuditQuery
+@param receiptId: ReceiptID for the transaction
+
+@returns string: Returns the complete receipt details for the transaction
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) AuditViewReceipt(ctx contractapi.TransactionContextInterface, auditLogId string, receiptId string) (string, error) {
+
+	/* Validates the logged-in auditor and the log of the query */
+	err := checkAuditLog(ctx, auditLogId, "AuditViewReceipt", receiptId)
+	if err != nil {
+		return "", err
+	}
+
+	/* Retrieving receipt details using the receipt ID */
+	receipt, err := getReceipt(ctx, receiptId)
+	if err != nil {
+		return "", err
+	}
+
+	return getReceiptView(ctx, receipt, false)
+}
+
+/*
+checkAuditLog verifies that the logged-in entity is an active Auditor and that the query has been logged on the
+ledger by it, within the validity of the log. As the log must be committed, queries that are only evaluated are
+refused unless LogAuditQuery was submitted beforehand.
+*/
+func checkAuditLog(ctx contractapi.TransactionContextInterface, auditLogId string, query string, targetId string) error {
+
+	/* Validates the logged-in auditor */
+	auditorDetails, auditorIdentity, err := getAuditor(ctx)
+	if err != nil {
+		return err
+	}
+
+	auditLogBytes, err := ctx.GetStub().GetState(auditLogId)
+	if err != nil {
+		return fmt.Errorf("Failed to get audit log %v: %v", auditLogId, err.Error())
+	}
+	if auditLogBytes == nil {
+		return fmt.Errorf("Audit log %v has not been committed, submit LogAuditQuery before running the query", auditLogId)
+	}
+
+	var auditLog AuditLog
+	err = json.Unmarshal(auditLogBytes, &auditLog)
+	if err != nil {
+		return err
+	}
+	if auditLog.DocType != AUDIT_LOG || auditLog.Query != query || auditLog.TargetId != targetId {
+		return fmt.Errorf("Audit log %v does not record %v on %v", auditLogId, query, targetId)
+	}
+	if auditLog.AuditorId != auditorDetails.Id || auditLog.AuditorIdentity != auditorIdentity {
+		return fmt.Errorf("Audit log %v was recorded by another auditor", auditLogId)
+	}
+
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if timestamp.Sub(auditLog.Timestamp) > AUDIT_LOG_VALIDITY {
+		return fmt.Errorf("Audit log %v has expired, log the query again", auditLogId)
+	}
+	return nil
+}
+
+/* getAuditor returns the logged-in Auditor along with its certificate identity */
+func getAuditor(ctx contractapi.TransactionContextInterface) (Entity, string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	auditorDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return Entity{}, "", err
+	}
+
+	/* Checks if the user role is that of an auditor */
+	if role != AUDITOR {
+		return Entity{}, "", fmt.Errorf("Only Auditors are allowed to run audit queries")
+	}
+
+	auditorIdentity, err := vaccinechainhelper.GetUserIdentityName(ctx)
+	if err != nil {
+		return Entity{}, "", err
+	}
+	return auditorDetails, auditorIdentity, nil
+}
@@ -0,0 +1,244 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type BatchRelease struct {
+	Id                string `json:"id"`
+	BatchId           string `json:"batchId"`
+	ManufacturerId    string `json:"manufacturerId"`
+	ProductId         string `json:"productId"`
+	LotNumber         string `json:"lotNumber"`
+	Decision          string `json:"decision"`
+	CertificateNo     string `json:"certificateNo"`
+	Remarks           string `json:"remarks,omitempty"`
+	DecisionDate      int64  `json:"decisionDate"`
+	RegulatorId       string `json:"regulatorId"`
+	RegulatorIdentity string `json:"regulatorIdentity"`
+	RegulatorMspId    string `json:"regulatorMspId"`
+	TxId              string `json:"txId"`
+	DocType           string `json:"docType"`
+}
+
+/*
+ReleaseBatch records the decision of the national regulatory authority on a batch created by AddBatch.
+It is exclusively called by the Regulator. An approved batch becomes available for distribution,
+a rejected batch can never be shipped. The decision is written once and cannot be changed afterwards.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param releaseInputString: JSON string with Batch release details
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) ReleaseBatch(ctx contractapi.TransactionContextInterface, releaseInputString string) error {
+	releaseInput := struct {
+		ManufacturerId string `json:"manufacturerId" validate:"required"`
+		BatchId        string `json:"batchId" validate:"required"`
+		Decision       string `json:"decision" validate:"required,oneof=APPROVED REJECTED"`
+		CertificateNo  string `json:"certificateNo" validate:"required"`
+		Remarks        string `json:"remarks"`
+		DecisionDate   int64  `json:"decisionDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(releaseInputString), &releaseInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for batch release: %v", err.Error())
+	}
+	fmt.Println("Input String:", releaseInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(releaseInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	regulatorDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is that of a regulator */
+	if role != REGULATOR {
+		return fmt.Errorf("Only the Regulator is allowed to release a batch")
+	}
+
+	/* Checks that no decision has been recorded for the batch yet */
+	releaseBytes, err := vaccinechainhelper.IsExist(ctx, releaseInput.BatchId, BATCH_RELEASE)
+	if err != nil {
+		return err
+	}
+	if releaseBytes != nil {
+		return fmt.Errorf("Release decision already recorded for batch with ID: %v", releaseInput.BatchId)
+	}
+
+	batchDetails, err := getBatch(ctx, releaseInput.ManufacturerId, releaseInput.BatchId)
+	if err != nil {
+		return err
+	}
+	if batchDetails.ReleaseStatus != ReleaseStatuses.PendingRelease {
+		return fmt.Errorf("Batch %v is not pending release", releaseInput.BatchId)
+	}
+
+	/* Captures the identity of the regulator taking the decision */
+	regulatorIdentity, err := vaccinechainhelper.GetUserIdentityName(ctx)
+	if err != nil {
+		return err
+	}
+	regulatorMspId, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("Failed to get MSP ID of the regulator: %v", err.Error())
+	}
+
+	release := BatchRelease{
+		Id:                releaseInput.BatchId,
+		BatchId:           releaseInput.BatchId,
+		ManufacturerId:    releaseInput.ManufacturerId,
+		ProductId:         batchDetails.ProductId,
+		LotNumber:         batchDetails.LotNumber,
+		Decision:          releaseInput.Decision,
+		CertificateNo:     releaseInput.CertificateNo,
+		Remarks:           releaseInput.Remarks,
+		DecisionDate:      releaseInput.DecisionDate,
+		RegulatorId:       regulatorDetails.Id,
+		RegulatorIdentity: regulatorIdentity,
+		RegulatorMspId:    regulatorMspId,
+		TxId:              ctx.GetStub().GetTxID(),
+		DocType:           BATCH_RELEASE,
+	}
+
+	/* Inserts the release decision into the ledger */
+	err = insertData(ctx, release, release.Id, BATCH_RELEASE)
+	if err != nil {
+		return err
+	}
+
+	/* Updates the release status of the batch */
+	if releaseInput.Decision == "APPROVED" {
+		batchDetails.ReleaseStatus = ReleaseStatuses.Released
+	} else {
+		batchDetails.ReleaseStatus = ReleaseStatuses.Rejected
+	}
+	err = insertData(ctx, batchDetails, releaseInput.ManufacturerId, releaseInput.BatchId)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Release Batch Function ******************")
+	return nil
+}
+
+/*
+ViewBatchRelease retrieves the release decision recorded by the Regulator for a batch.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param batchId: ID of the batch
+
+@returns string: Returns the JSON-encoded release decision
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) ViewBatchRelease(ctx contractapi.TransactionContextInterface, batchId string) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	_, _, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	releaseBytes, err := vaccinechainhelper.IsExist(ctx, batchId, BATCH_RELEASE)
+	if err != nil {
+		return "", err
+	}
+	if releaseBytes == nil {
+		return "", fmt.Errorf("No release decision recorded for batch with ID: %v", batchId)
+	}
+
+	return string(releaseBytes), nil
+}
+
+/*
+getBatch returns the details of a batch. Batches created before the release workflow carry no release status
+and are treated as pending release, so that the Regulator can still release them.
+*/
+func getBatch(ctx contractapi.TransactionContextInterface, manufacturerId string, batchId string) (Batch, error) {
+	batchBytes, err := vaccinechainhelper.IsExist(ctx, manufacturerId, batchId)
+	if err != nil {
+		return Batch{}, err
+	}
+	if batchBytes == nil {
+		return Batch{}, fmt.Errorf("Batch %v does not exist for manufacturer %v", batchId, manufacturerId)
+	}
+
+	var batchDetails Batch
+	err = json.Unmarshal(batchBytes, &batchDetails)
+	if err != nil {
+		return Batch{}, fmt.Errorf("Failed to convert batch details: %v", err.Error())
+	}
+	if batchDetails.ReleaseStatus == "" {
+		batchDetails.ReleaseStatus = ReleaseStatuses.PendingRelease
+	}
+	return batchDetails, nil
+}
+
+/* getRecordedReleaseStatus returns the release status set by the release decision of the Regulator on a batch */
+func getRecordedReleaseStatus(ctx contractapi.TransactionContextInterface, batchId string) (string, error) {
+	releaseBytes, err := vaccinechainhelper.IsExist(ctx, batchId, BATCH_RELEASE)
+	if err != nil {
+		return "", err
+	}
+	if releaseBytes == nil {
+		return ReleaseStatuses.PendingRelease, nil
+	}
+
+	var release BatchRelease
+	err = json.Unmarshal(releaseBytes, &release)
+	if err != nil {
+		return "", fmt.Errorf("Failed to convert release decision: %v", err.Error())
+	}
+	if release.Decision == "APPROVED" {
+		return ReleaseStatuses.Released, nil
+	}
+	return ReleaseStatuses.Rejected, nil
+}
+
+func checkBatchReleased(ctx contractapi.TransactionContextInterface, manufacturerId string, batchId string) error {
+	batchDetails, err := getBatch(ctx, manufacturerId, batchId)
+	if err != nil {
+		return err
+	}
+	if batchDetails.ReleaseStatus != ReleaseStatuses.Released {
+		return fmt.Errorf("Batch %v has not been released by the Regulator", batchId)
+	}
+	if batchDetails.Suspended {
+		return fmt.Errorf("Batch %v is suspended", batchId)
+	}
+	return nil
+}
+
+/*
+checkBatchNotHeld refuses further movement of assets from a batch that has been rejected, put on hold
+or suspended after leaving the manufacturer.
+*/
+func checkBatchNotHeld(ctx contractapi.TransactionContextInterface, manufacturerId string, batchId string) error {
+	batchDetails, err := getBatch(ctx, manufacturerId, batchId)
+	if err != nil {
+		return err
+	}
+	if batchDetails.ReleaseStatus == ReleaseStatuses.OnHold || batchDetails.ReleaseStatus == ReleaseStatuses.Rejected {
+		return fmt.Errorf("Batch %v is %v and its assets cannot be moved", batchId, batchDetails.ReleaseStatus)
+	}
+	if batchDetails.Suspended {
+		return fmt.Errorf("Batch %v is suspended and its assets cannot be moved", batchId)
+	}
+	return nil
+}
@@ -0,0 +1,527 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Type of the proof attached to certificates. The proof carries the ECDSA signature of the issuer over the payload hash
+of the credential together with the X.509 certificate of the issuer, so it can be checked offline against the MSP of
+the issuer, and points to the ledger record anchoring the hash for VerifyVaccinationCertificate.
+*/
+const CERTIFICATE_PROOF_TYPE = "VaccineChainLedgerProof"
+
+/* VaccinationCredential is a ledger-anchored W3C Verifiable Credential describing an administered or sold dose */
+type VaccinationCredential struct {
+	Context           []string          `json:"@context"`
+	Id                string            `json:"id"`
+	Type              []string          `json:"type"`
+	Issuer            string            `json:"issuer"`
+	IssuanceDate      string            `json:"issuanceDate"`
+	CredentialSubject CredentialSubject `json:"credentialSubject"`
+	Proof             *CredentialProof  `json:"proof,omitempty"`
+}
+
+type CredentialSubject struct {
+	Id                string `json:"id"`
+	Event             string `json:"event"`
+	PacketId          string `json:"packetId"`
+	ProductId         string `json:"productId"`
+	ProductName       string `json:"productName"`
+	ManufacturerId    string `json:"manufacturerId"`
+	ManufacturerName  string `json:"manufacturerName"`
+	BatchId           string `json:"batchId"`
+	LotNumber         string `json:"lotNumber"`
+	DoseNumber        int16  `json:"doseNumber,omitempty"`
+	DateOfVaccination int64  `json:"dateOfVaccination"`
+}
+
+/*
+CredentialProof anchors a credential in the ledger and carries the signature of the issuer over its payload hash,
+as a base64 ASN.1 DER ECDSA signature, along with the PEM-encoded certificate that verifies it.
+*/
+type CredentialProof struct {
+	Type               string `json:"type"`
+	Created            string `json:"created"`
+	IssuerMspId        string `json:"issuerMspId"`
+	LedgerTxId         string `json:"ledgerTxId"`
+	PayloadHash        string `json:"payloadHash"`
+	VerificationMethod string `json:"verificationMethod,omitempty"`
+	ProofValue         string `json:"proofValue,omitempty"`
+}
+
+/* Certificate is the ledger record against which an issued credential is verified */
+type Certificate struct {
+	Id             string                `json:"id"`
+	CredentialId   string                `json:"credentialId"`
+	PayloadHash    string                `json:"payloadHash"`
+	PatientRef     string                `json:"patientRef"`
+	PacketId       string                `json:"packetId"`
+	RecordId       string                `json:"recordId,omitempty"`
+	BatchId        string                `json:"batchId"`
+	ManufacturerId string                `json:"manufacturerId"`
+	IssuedBy       string                `json:"issuedBy"`
+	IssuedAt       string                `json:"issuedAt"`
+	IssuerMspId    string                `json:"issuerMspId"`
+	Signature      string                `json:"signature,omitempty"`
+	SignerCert     string                `json:"signerCert,omitempty"`
+	Credential     VaccinationCredential `json:"credential"`
+	DocType        string                `json:"docType"`
+}
+
+type CertificateVerification struct {
+	Valid   bool     `json:"valid"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+/*
+IssueVaccinationCertificate issues a ledger-anchored W3C Verifiable Credential for a dose, built from the ledger records of the
+vaccination, asset, batch and product. It is called by the Chemist, Hospital or Clinic. The certificate is issued either for
+a vaccination record or for a packet sold to the patient, and the patient identifier and its salt must be passed
+through the transient map under the key "patient". The hash of the credential is anchored in the ledger, and the
+returned credential must then be signed by the issuer over its payload hash with SignVaccinationCertificate.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param certificateInputString: JSON string with the vaccination record ID or the packet ID
+
+@returns string: Returns the JSON-encoded verifiable credential, whose proof is not signed yet
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) IssueVaccinationCertificate(ctx contractapi.TransactionContextInterface, certificateInputString string) (string, error) {
+	certificateInput := struct {
+		VaccinationRecordId string `json:"vaccinationRecordId" validate:"required_without=PacketId"`
+		PacketId            string `json:"packetId" validate:"required_without=VaccinationRecordId"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(certificateInputString), &certificateInput)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the input string for certificate: %v", err.Error())
+	}
+	fmt.Println("Input String:", certificateInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(certificateInput)
+	if err != nil {
+		return "", err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	chemistDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is that of a chemist, hospital or clinic */
+	if !isDispensingRole(role) {
+		return "", fmt.Errorf("Only Chemists, Hospitals and Clinics are allowed to issue vaccination certificates")
+	}
+
+	/* Identifies the patient the certificate is issued to */
+	patient, err := getTransientPatient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Builds the credential subject from the vaccination record or from the sold packet */
+	var subject CredentialSubject
+	var recordId string
+	if certificateInput.VaccinationRecordId != "" {
+		var vaccinationRecord VaccinationRecord
+		recordBytes, err := ctx.GetStub().GetState(certificateInput.VaccinationRecordId)
+		if err != nil {
+			return "", fmt.Errorf("failed to get vaccination record %s: %v", certificateInput.VaccinationRecordId, err)
+		}
+		if recordBytes == nil {
+			return "", fmt.Errorf("Vaccination record does not exist for ID: %s", certificateInput.VaccinationRecordId)
+		}
+		err = json.Unmarshal(recordBytes, &vaccinationRecord)
+		if err != nil {
+			return "", err
+		}
+		if vaccinationRecord.DocType != VACCINATION_RECORD || vaccinationRecord.PatientRef != patient.Id {
+			return "", fmt.Errorf("Vaccination record %s does not belong to the patient", certificateInput.VaccinationRecordId)
+		}
+
+		recordId = vaccinationRecord.Id
+		subject = CredentialSubject{
+			Event:             AssetStatuses.Administered,
+			PacketId:          vaccinationRecord.PacketId,
+			DoseNumber:        vaccinationRecord.DoseNumber,
+			DateOfVaccination: vaccinationRecord.AdministeredDate,
+		}
+	} else {
+		asset, err := getAsset(ctx, certificateInput.PacketId)
+		if err != nil {
+			return "", err
+		}
+		if asset.Owner != patient.Id || asset.Status != vaccinechainhelper.Statuses.SoldToCustomer {
+			return "", fmt.Errorf("Packet %s has not been sold to the patient", certificateInput.PacketId)
+		}
+
+		receipts, err := getReceiptsForSelector(ctx, map[string]interface{}{
+			"docType":    vaccinechainhelper.RECEIPT,
+			"bundleId":   asset.Id,
+			"customerId": patient.Id,
+		})
+		if err != nil {
+			return "", err
+		}
+		if len(receipts) == 0 {
+			return "", fmt.Errorf("No sale receipt found for packet %s", asset.Id)
+		}
+
+		subject = CredentialSubject{
+			Event:             vaccinechainhelper.Statuses.SoldToCustomer,
+			PacketId:          asset.Id,
+			DateOfVaccination: receipts[0].TransactionDate,
+		}
+	}
+
+	/* Completes the credential subject from the asset, batch and product records */
+	asset, err := getAsset(ctx, subject.PacketId)
+	if err != nil {
+		return "", err
+	}
+	productDetails, manufacturerDetails, err := getProductAndManufacturer(ctx, asset.ProductId, asset.ManufacturerId)
+	if err != nil {
+		return "", err
+	}
+	subject.Id = "urn:vaccinechain:patient:" + patient.Id
+	subject.ProductId = asset.ProductId
+	subject.ProductName = productDetails.Name
+	subject.ManufacturerId = asset.ManufacturerId
+	subject.ManufacturerName = manufacturerDetails.Name
+	subject.BatchId = asset.BatchId
+	subject.LotNumber = asset.LotNumber
+
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	issuerMspId, err := getCallerMspId(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	credential := VaccinationCredential{
+		Context:           []string{"https://www.w3.org/2018/credentials/v1"},
+		Id:                "urn:vaccinechain:certificate:" + txID,
+		Type:              []string{"VerifiableCredential", "VaccinationCertificate"},
+		Issuer:            "urn:vaccinechain:entity:" + chemistDetails.Id,
+		IssuanceDate:      timestamp.UTC().Format(time.RFC3339),
+		CredentialSubject: subject,
+	}
+
+	payloadHash, err := credentialHash(credential)
+	if err != nil {
+		return "", err
+	}
+
+	certificate := Certificate{
+		Id:             txID,
+		CredentialId:   credential.Id,
+		PayloadHash:    payloadHash,
+		PatientRef:     patient.Id,
+		PacketId:       asset.Id,
+		RecordId:       recordId,
+		BatchId:        asset.BatchId,
+		ManufacturerId: asset.ManufacturerId,
+		IssuedBy:       chemistDetails.Id,
+		IssuedAt:       credential.IssuanceDate,
+		IssuerMspId:    issuerMspId,
+		Credential:     credential,
+		DocType:        CERTIFICATE,
+	}
+
+	/* Inserts the certificate record into the ledger */
+	err = insertData(ctx, certificate, txID, "")
+	if err != nil {
+		return "", err
+	}
+
+	credential.Proof = certificateProof(certificate)
+
+	credentialJSON, err := json.Marshal(credential)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("********** End of Issue Vaccination Certificate Function ******************")
+	return string(credentialJSON), nil
+}
+
+/*
+SignVaccinationCertificate attaches the signature of the issuer to a certificate. It is called by the Chemist, Hospital
+or Clinic that issued the certificate, with its ECDSA signature over the payload hash of the credential. The signature
+is verified against the X.509 certificate of the caller, and both are stored with the certificate and embedded in
+the proof of the returned credential.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param signatureInputString: JSON string with the certificate ID and the base64 ASN.1 DER signature of the payload hash
+
+@returns string: Returns the JSON-encoded verifiable credential with its signed proof
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) SignVaccinationCertificate(ctx contractapi.TransactionContextInterface, signatureInputString string) (string, error) {
+	signatureInput := struct {
+		CertificateId string `json:"certificateId" validate:"required"`
+		Signature     string `json:"signature" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(signatureInputString), &signatureInput)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the input string for certificate signature: %v", err.Error())
+	}
+	fmt.Println("Input String:", signatureInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(signatureInput)
+	if err != nil {
+		return "", err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	chemistDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is that of a chemist, hospital or clinic */
+	if !isDispensingRole(role) {
+		return "", fmt.Errorf("Only Chemists, Hospitals and Clinics are allowed to sign vaccination certificates")
+	}
+
+	/* Fetches the certificate and checks that the caller issued it */
+	certificate, err := getCertificate(ctx, signatureInput.CertificateId)
+	if err != nil {
+		return "", err
+	}
+	if certificate.IssuedBy != chemistDetails.Id {
+		return "", fmt.Errorf("Certificate %v was not issued by %v", certificate.Id, chemistDetails.Id)
+	}
+	if certificate.Signature != "" {
+		return "", fmt.Errorf("Certificate %v is already signed", certificate.Id)
+	}
+
+	/* Verifies the signature against the certificate of the caller */
+	signerCert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get the certificate of the caller: %v", err.Error())
+	}
+	if signerCert == nil {
+		return "", fmt.Errorf("Caller does not have an X.509 certificate")
+	}
+	err = verifyPayloadSignature(signerCert, certificate.PayloadHash, signatureInput.Signature)
+	if err != nil {
+		return "", err
+	}
+
+	certificate.Signature = signatureInput.Signature
+	certificate.SignerCert = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signerCert.Raw}))
+
+	/* Updates the certificate record in the ledger */
+	err = insertData(ctx, certificate, certificate.Id, "")
+	if err != nil {
+		return "", err
+	}
+
+	credential := certificate.Credential
+	credential.Proof = certificateProof(certificate)
+
+	credentialJSON, err := json.Marshal(credential)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("********** End of Sign Vaccination Certificate Function ******************")
+	return string(credentialJSON), nil
+}
+
+/*
+VerifyVaccinationCertificate checks a vaccination certificate against the ledger. The credential must match the hash
+anchored at issuance, its proof must carry a valid signature of the issuer by the certificate stored at signing, and the batch of the dose must still be released, i.e. not rejected or recalled since.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param credentialString: JSON-encoded verifiable credential as returned by IssueVaccinationCertificate
+
+@returns string: Returns the JSON-encoded verification result with the reasons of any failure
+@returns error: Returns an error if the credential cannot be parsed or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) VerifyVaccinationCertificate(ctx contractapi.TransactionContextInterface, credentialString string) (string, error) {
+	var credential VaccinationCredential
+	err := json.Unmarshal([]byte(credentialString), &credential)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the vaccination certificate: %v", err.Error())
+	}
+	if credential.Proof == nil || credential.Proof.Type != CERTIFICATE_PROOF_TYPE {
+		return "", fmt.Errorf("Vaccination certificate does not carry a %v proof", CERTIFICATE_PROOF_TYPE)
+	}
+
+	verification := CertificateVerification{Valid: true}
+	fail := func(reason string) {
+		verification.Valid = false
+		verification.Reasons = append(verification.Reasons, reason)
+	}
+
+	/* Checks the credential against the hash anchored in the ledger */
+	certificate, err := getCertificate(ctx, credential.Proof.LedgerTxId)
+	if err != nil {
+		fail(err.Error())
+	} else if certificate.CredentialId != credential.Id {
+		fail("certificate was not issued on the ledger")
+	} else {
+		proof := credential.Proof
+		credential.Proof = nil
+		payloadHash, err := credentialHash(credential)
+		if err != nil {
+			return "", err
+		}
+		if payloadHash != certificate.PayloadHash || proof.PayloadHash != certificate.PayloadHash {
+			fail("certificate content does not match the ledger record")
+		}
+
+		/* Checks the signature of the issuer with the certificate embedded in the proof */
+		if proof.ProofValue == "" || proof.VerificationMethod == "" {
+			fail("certificate is not signed by its issuer")
+		} else if proof.VerificationMethod != certificate.SignerCert || proof.ProofValue != certificate.Signature {
+			fail("certificate signature does not match the ledger record")
+		} else {
+			signerCert, err := parseSignerCert(proof.VerificationMethod)
+			if err == nil {
+				err = verifyPayloadSignature(signerCert, payloadHash, proof.ProofValue)
+			}
+			if err != nil {
+				fail(err.Error())
+			}
+		}
+
+		/* Checks that the batch has not been rejected or recalled since issuance */
+		batchDetails, err := getBatch(ctx, certificate.ManufacturerId, certificate.BatchId)
+		if err != nil {
+			fail(err.Error())
+		} else if batchDetails.ReleaseStatus != ReleaseStatuses.Released {
+			fail(fmt.Sprintf("batch %v is %v", batchDetails.Id, batchDetails.ReleaseStatus))
+		}
+	}
+
+	verificationJSON, err := json.Marshal(verification)
+	if err != nil {
+		return "", err
+	}
+
+	return string(verificationJSON), nil
+}
+
+func getCertificate(ctx contractapi.TransactionContextInterface, certificateId string) (Certificate, error) {
+	var certificate Certificate
+	certificateBytes, err := ctx.GetStub().GetState(certificateId)
+	if err != nil {
+		return Certificate{}, fmt.Errorf("failed to get certificate %s: %v", certificateId, err)
+	}
+	if certificateBytes == nil {
+		return Certificate{}, fmt.Errorf("certificate %s was not issued on the ledger", certificateId)
+	}
+	err = json.Unmarshal(certificateBytes, &certificate)
+	if err != nil {
+		return Certificate{}, err
+	}
+	if certificate.DocType != CERTIFICATE {
+		return Certificate{}, fmt.Errorf("certificate %s was not issued on the ledger", certificateId)
+	}
+
+	return certificate, nil
+}
+
+/* certificateProof builds the proof of a credential from its certificate record */
+func certificateProof(certificate Certificate) *CredentialProof {
+	return &CredentialProof{
+		Type:               CERTIFICATE_PROOF_TYPE,
+		Created:            certificate.IssuedAt,
+		IssuerMspId:        certificate.IssuerMspId,
+		LedgerTxId:         certificate.Id,
+		PayloadHash:        certificate.PayloadHash,
+		VerificationMethod: certificate.SignerCert,
+		ProofValue:         certificate.Signature,
+	}
+}
+
+/* verifyPayloadSignature checks a base64 ASN.1 DER ECDSA signature over a hex-encoded payload hash */
+func verifyPayloadSignature(signerCert *x509.Certificate, payloadHash string, signature string) error {
+	publicKey, ok := signerCert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("certificate of the signer does not carry an ECDSA public key")
+	}
+	digest, err := hex.DecodeString(payloadHash)
+	if err != nil {
+		return fmt.Errorf("invalid payload hash: %v", err.Error())
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err.Error())
+	}
+	if !ecdsa.VerifyASN1(publicKey, digest, signatureBytes) {
+		return fmt.Errorf("signature does not match the payload hash of the certificate")
+	}
+
+	return nil
+}
+
+func parseSignerCert(signerCertPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(signerCertPEM))
+	if block == nil {
+		return nil, fmt.Errorf("invalid certificate of the signer")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+/* credentialHash returns the hash of a credential without its proof */
+func credentialHash(credential VaccinationCredential) (string, error) {
+	credential.Proof = nil
+	credentialJSON, err := json.Marshal(credential)
+	if err != nil {
+		return "", fmt.Errorf("Failed to marshal vaccination certificate: %v", err.Error())
+	}
+
+	hash := sha256.Sum256(credentialJSON)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func getProductAndManufacturer(ctx contractapi.TransactionContextInterface, productId string, manufacturerId string) (Product, Entity, error) {
+	productDetails, err := getProduct(ctx, productId, manufacturerId)
+	if err != nil {
+		return Product{}, Entity{}, err
+	}
+
+	var manufacturerDetails Entity
+	manufacturerBytes, err := vaccinechainhelper.IsExist(ctx, manufacturerId, vaccinechainhelper.MANUFACTURER)
+	if err != nil {
+		return Product{}, Entity{}, err
+	}
+	if manufacturerBytes == nil {
+		return Product{}, Entity{}, fmt.Errorf("Record does not exist with ID: %v", manufacturerId)
+	}
+	err = json.Unmarshal(manufacturerBytes, &manufacturerDetails)
+	if err != nil {
+		return Product{}, Entity{}, err
+	}
+
+	return productDetails, manufacturerDetails, nil
+}
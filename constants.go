@@ -0,0 +1,182 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+/* Document types used by this chaincode in addition to those defined in vaccinechainhelper */
+const (
+	LOT           = "LOT"
+	REGULATOR     = "REGULATOR"
+	BATCH_RELEASE = "BATCH_RELEASE"
+	AUDITOR       = "AUDITOR"
+	AUDIT_LOG     = "AUDIT_LOG"
+
+	RECEIPT_AMENDMENT = "RECEIPT_AMENDMENT"
+	CREDIT_NOTE       = "CREDIT_NOTE"
+	DEBIT_NOTE        = "DEBIT_NOTE"
+	RECEIPT_PRICING   = "RECEIPT_PRICING"
+	PATIENT           = "PATIENT"
+
+	VACCINATION_RECORD = "VACCINATION_RECORD"
+	CERTIFICATE        = "CERTIFICATE"
+
+	ADVERSE_EVENT        = "ADVERSE_EVENT"
+	ADVERSE_EVENT_SIGNAL = "ADVERSE_EVENT_SIGNAL"
+	ADVERSE_EVENT_PACKET = "ADVERSE_EVENT_PACKET"
+	BATCH_HOLD_DECISION  = "BATCH_HOLD_DECISION"
+	CONFIG               = "CONFIG"
+
+	WASTE_HANDLER    = "WASTE_HANDLER"
+	DISPOSAL_REQUEST = "DISPOSAL_REQUEST"
+	INCIDENT         = "INCIDENT"
+	INCIDENT_ALERT   = "INCIDENT_ALERT"
+	FEFO_OVERRIDE    = "FEFO_OVERRIDE"
+
+	HOSPITAL = "HOSPITAL"
+	CLINIC   = "CLINIC"
+
+	LOGISTICS = "LOGISTICS"
+	SHIPMENT  = "SHIPMENT"
+	LOCATION  = "LOCATION"
+
+	ALLOCATION = "ALLOCATION"
+
+	LICENSE_RENEWAL = "LICENSE_RENEWAL"
+
+	STRANDED_TRANSFER = "STRANDED_TRANSFER"
+
+	BATCH         = "BATCH"
+	STATUS_CHANGE = "STATUS_CHANGE"
+
+	SUPER_ADMIN_ROLE     = "SUPER_ADMIN"
+	SUPER_ADMIN_CONFIG   = "SUPER_ADMIN_CONFIG"
+	SUPER_ADMIN_ROTATION = "SUPER_ADMIN_ROTATION"
+)
+
+/*
+MSP ID of the organization the super admin identity vaccinechainhelper.SUPER_ADMIN is trusted from, until the
+super admins are recorded on the ledger with InitLedger. Set it for the network before deploying the chaincode.
+*/
+const SUPER_ADMIN_MSP_ID = "Org1MSP"
+
+/*
+Number of records a rich query returns at most, matching ledger.state.couchDBConfig.totalQueryLimit of the peers.
+Update transactions cannot page through results, so they refuse to act on a result that reaches it.
+*/
+const TOTAL_QUERY_LIMIT = 100000
+
+/* Number of records read per page by the reports paging through their query results */
+const QUERY_PAGE_SIZE int32 = 1000
+
+/* Asset statuses used by this chaincode in addition to vaccinechainhelper.Statuses */
+var AssetStatuses = struct {
+	Administered      string
+	VialOpened        string
+	VialConsumed      string
+	VialDiscarded     string
+	DisposalRequested string
+	Destroyed         string
+	Frozen            string
+	WrittenOff        string
+}{
+	Administered:      "Administered",
+	VialOpened:        "VialOpened",
+	VialConsumed:      "VialConsumed",
+	VialDiscarded:     "VialDiscarded",
+	DisposalRequested: "DisposalRequested",
+	Destroyed:         "Destroyed",
+	Frozen:            "Frozen",
+	WrittenOff:        "WrittenOff",
+}
+
+/* Asset statuses in which an asset can no longer be shipped to another owner */
+var blockedAssetStatuses = map[string]bool{
+	AssetStatuses.DisposalRequested: true,
+	AssetStatuses.Destroyed:         true,
+	AssetStatuses.Frozen:            true,
+	AssetStatuses.WrittenOff:        true,
+}
+
+/* States of a DisposalRequest */
+var DisposalStatuses = struct {
+	Requested string
+	Witnessed string
+	Cancelled string
+	Rejected  string
+}{
+	Requested: "REQUESTED",
+	Witnessed: "WITNESSED",
+	Cancelled: "CANCELLED",
+	Rejected:  "REJECTED",
+}
+
+/* Regulatory release states of a Batch */
+var ReleaseStatuses = struct {
+	PendingRelease string
+	Released       string
+	Rejected       string
+	OnHold         string
+}{
+	PendingRelease: "PENDING_RELEASE",
+	Released:       "RELEASED",
+	Rejected:       "REJECTED",
+	OnHold:         "ON_HOLD",
+}
+
+/* States of a Receipt */
+var ReceiptStatuses = struct {
+	Active     string
+	Superseded string
+}{
+	Active:     "ACTIVE",
+	Superseded: "SUPERSEDED",
+}
+
+/* States of a ReceiptAmendment */
+var AmendmentStatuses = struct {
+	Proposed string
+	Approved string
+	Rejected string
+}{
+	Proposed: "PROPOSED",
+	Approved: "APPROVED",
+	Rejected: "REJECTED",
+}
+
+/* States of an Incident */
+var IncidentStatuses = struct {
+	Open       string
+	Recovered  string
+	WrittenOff string
+}{
+	Open:       "OPEN",
+	Recovered:  "RECOVERED",
+	WrittenOff: "WRITTEN_OFF",
+}
+
+/* Expiry buckets of the stock-on-hand report, by days left before expiry */
+var ExpiryBuckets = struct {
+	Expired   string
+	Within30  string
+	Within90  string
+	Within180 string
+	Beyond180 string
+}{
+	Expired:   "EXPIRED",
+	Within30:  "0-30_DAYS",
+	Within90:  "31-90_DAYS",
+	Within180: "91-180_DAYS",
+	Beyond180: "180+_DAYS",
+}
+
+/* States of a Shipment */
+var ShipmentStatuses = struct {
+	Booked    string
+	InTransit string
+	Delivered string
+}{
+	Booked:    "BOOKED",
+	InTransit: "IN_TRANSIT",
+	Delivered: "DELIVERED",
+}
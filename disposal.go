@@ -0,0 +1,355 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type DisposalRequest struct {
+	Id              string   `json:"id"`
+	RequestedBy     string   `json:"requestedBy"`
+	AssetIds        []string `json:"assetIds"`
+	Reason          string   `json:"reason"`
+	Remarks         string   `json:"remarks,omitempty"`
+	RequestDate     int64    `json:"requestDate"`
+	Status          string   `json:"status"`
+	WitnessId       string   `json:"witnessId,omitempty"`
+	WitnessRole     string   `json:"witnessRole,omitempty"`
+	DisposalMethod  string   `json:"disposalMethod,omitempty"`
+	CertificateRef  string   `json:"certificateRef,omitempty"`
+	DestructionDate int64    `json:"destructionDate,omitempty"`
+	ClosedBy        string   `json:"closedBy,omitempty"`
+	ClosingReason   string   `json:"closingReason,omitempty"`
+	ClosingDate     int64    `json:"closingDate,omitempty"`
+	DocType         string   `json:"docType"`
+}
+
+/*
+RequestDisposal requests the destruction of expired or damaged assets held by the logged-in entity.
+It is called by the Manufacturer, the Distributor, the Chemist, the Hospital or the Clinic. The listed assets can no longer be shipped
+or administered until the destruction has been witnessed, or the request cancelled or rejected with CancelDisposal.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param disposalInputString: JSON string with the assets to be destroyed and the reason
+
+@returns string: Returns the ID of the disposal request
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) RequestDisposal(ctx contractapi.TransactionContextInterface, disposalInputString string) (string, error) {
+	disposalInput := struct {
+		AssetIds    []string `json:"assetIds" validate:"required,min=1,dive,required"`
+		Reason      string   `json:"reason" validate:"required,oneof=EXPIRED DAMAGED RECALLED OTHER"`
+		Remarks     string   `json:"remarks"`
+		RequestDate int64    `json:"requestDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(disposalInputString), &disposalInput)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the input string for disposal request: %v", err.Error())
+	}
+	fmt.Println("Input String:", disposalInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(disposalInput)
+	if err != nil {
+		return "", err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	holderDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is allowed to hold inventory */
+	if role != vaccinechainhelper.MANUFACTURER && role != vaccinechainhelper.DISTRIBUTER && !isDispensingRole(role) {
+		return "", fmt.Errorf("Only entities holding inventory are allowed to request disposal")
+	}
+
+	/* Marks every listed asset as awaiting disposal */
+	requested := make(map[string]bool)
+	for _, assetId := range disposalInput.AssetIds {
+		if requested[assetId] {
+			return "", fmt.Errorf("Asset %v is listed more than once", assetId)
+		}
+		requested[assetId] = true
+
+		asset, err := getAsset(ctx, assetId)
+		if err != nil {
+			return "", err
+		}
+		if asset.Owner != holderDetails.Id {
+			return "", fmt.Errorf("Asset %v is not held by %v", asset.Id, holderDetails.Id)
+		}
+		if blockedAssetStatuses[asset.Status] || asset.Status == AssetStatuses.Administered ||
+			asset.Status == vaccinechainhelper.Statuses.SoldToCustomer {
+			return "", fmt.Errorf("Asset %v in status %v cannot be disposed of", asset.Id, asset.Status)
+		}
+
+		asset.PreviousStatus = asset.Status
+		asset.Status = AssetStatuses.DisposalRequested
+		err = insertData(ctx, asset, asset.Id, "")
+		if err != nil {
+			return "", err
+		}
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	disposalRequest := DisposalRequest{
+		Id:          txID,
+		RequestedBy: holderDetails.Id,
+		AssetIds:    disposalInput.AssetIds,
+		Reason:      disposalInput.Reason,
+		Remarks:     disposalInput.Remarks,
+		RequestDate: disposalInput.RequestDate,
+		Status:      DisposalStatuses.Requested,
+		DocType:     DISPOSAL_REQUEST,
+	}
+
+	/* Inserts the disposal request into the ledger */
+	err = insertData(ctx, disposalRequest, txID, "")
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("********** End of Request Disposal Function ******************")
+	return txID, nil
+}
+
+/*
+WitnessDisposal certifies the destruction of the assets of a disposal request. It is called by an authorized
+Waste Handler or the Regulator. The assets move to the destroyed status with the disposal certificate reference,
+after which they no longer appear in inventory queries.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param witnessInputString: JSON string with the disposal request and the certificate details
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) WitnessDisposal(ctx contractapi.TransactionContextInterface, witnessInputString string) error {
+	witnessInput := struct {
+		RequestId       string `json:"requestId" validate:"required"`
+		DisposalMethod  string `json:"disposalMethod" validate:"required"`
+		CertificateRef  string `json:"certificateRef" validate:"required"`
+		DestructionDate int64  `json:"destructionDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(witnessInputString), &witnessInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for disposal witness: %v", err.Error())
+	}
+	fmt.Println("Input String:", witnessInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(witnessInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	witnessDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is allowed to witness a destruction */
+	if role != WASTE_HANDLER && role != REGULATOR {
+		return fmt.Errorf("Only Waste Handlers and the Regulator are allowed to witness a disposal")
+	}
+
+	disposalRequest, err := getDisposalRequest(ctx, witnessInput.RequestId)
+	if err != nil {
+		return err
+	}
+	if disposalRequest.Status != DisposalStatuses.Requested {
+		return fmt.Errorf("Disposal request %v is already %v", disposalRequest.Id, disposalRequest.Status)
+	}
+	if witnessInput.DestructionDate < disposalRequest.RequestDate {
+		return fmt.Errorf("Destruction date cannot be earlier than the request date")
+	}
+
+	/* Moves every asset of the request to the destroyed status */
+	for _, assetId := range disposalRequest.AssetIds {
+		asset, err := getAsset(ctx, assetId)
+		if err != nil {
+			return err
+		}
+		if asset.Owner != disposalRequest.RequestedBy || asset.Status != AssetStatuses.DisposalRequested {
+			return fmt.Errorf("Asset %v is no longer awaiting disposal by %v", asset.Id, disposalRequest.RequestedBy)
+		}
+
+		asset.Status = AssetStatuses.Destroyed
+		asset.PreviousStatus = ""
+		asset.DisposalRef = witnessInput.CertificateRef
+		err = insertData(ctx, asset, asset.Id, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	/* Records the disposal certificate on the request */
+	disposalRequest.Status = DisposalStatuses.Witnessed
+	disposalRequest.WitnessId = witnessDetails.Id
+	disposalRequest.WitnessRole = role
+	disposalRequest.DisposalMethod = witnessInput.DisposalMethod
+	disposalRequest.CertificateRef = witnessInput.CertificateRef
+	disposalRequest.DestructionDate = witnessInput.DestructionDate
+	err = insertData(ctx, disposalRequest, disposalRequest.Id, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Witness Disposal Function ******************")
+	return nil
+}
+
+/*
+CancelDisposal closes a pending disposal request without destroying its assets, which return to the status they
+had before the request. It is called by the requesting entity, which cancels the request, or by a Waste Handler or
+the Regulator, which reject it.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param cancelInputString: JSON string with the disposal request, the reason and the date
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) CancelDisposal(ctx contractapi.TransactionContextInterface, cancelInputString string) error {
+	cancelInput := struct {
+		RequestId   string `json:"requestId" validate:"required"`
+		Reason      string `json:"reason" validate:"required"`
+		ClosingDate int64  `json:"closingDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(cancelInputString), &cancelInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for disposal cancellation: %v", err.Error())
+	}
+	fmt.Println("Input String:", cancelInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(cancelInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	disposalRequest, err := getDisposalRequest(ctx, cancelInput.RequestId)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user is allowed to cancel or reject the request */
+	status := DisposalStatuses.Cancelled
+	if disposalRequest.RequestedBy != entityDetails.Id {
+		if role != WASTE_HANDLER && role != REGULATOR {
+			return fmt.Errorf("Only the requesting entity, Waste Handlers and the Regulator are allowed to close disposal request %v", disposalRequest.Id)
+		}
+		status = DisposalStatuses.Rejected
+	}
+	if disposalRequest.Status != DisposalStatuses.Requested {
+		return fmt.Errorf("Disposal request %v is already %v", disposalRequest.Id, disposalRequest.Status)
+	}
+	if cancelInput.ClosingDate < disposalRequest.RequestDate {
+		return fmt.Errorf("Closing date cannot be earlier than the request date")
+	}
+
+	/* Returns every asset still awaiting disposal to its previous status */
+	for _, assetId := range disposalRequest.AssetIds {
+		asset, err := getAsset(ctx, assetId)
+		if err != nil {
+			return err
+		}
+		if asset.Owner != disposalRequest.RequestedBy || asset.Status != AssetStatuses.DisposalRequested {
+			continue
+		}
+
+		asset.Status = asset.PreviousStatus
+		asset.PreviousStatus = ""
+		err = insertData(ctx, asset, asset.Id, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	disposalRequest.Status = status
+	disposalRequest.ClosedBy = entityDetails.Id
+	disposalRequest.ClosingReason = cancelInput.Reason
+	disposalRequest.ClosingDate = cancelInput.ClosingDate
+	err = insertData(ctx, disposalRequest, disposalRequest.Id, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Cancel Disposal Function ******************")
+	return nil
+}
+
+/*
+ViewDisposalRequest retrieves a disposal request. It is called by the requesting entity,
+a Waste Handler or the Regulator.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param requestId: ID of the disposal request
+
+@returns string: Returns the JSON-encoded disposal request
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) ViewDisposalRequest(ctx contractapi.TransactionContextInterface, requestId string) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	disposalRequest, err := getDisposalRequest(ctx, requestId)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user is allowed to view the request */
+	if disposalRequest.RequestedBy != entityDetails.Id && role != WASTE_HANDLER && role != REGULATOR {
+		return "", fmt.Errorf("You are not authorized to view disposal request %v", requestId)
+	}
+
+	disposalRequestJSON, err := json.Marshal(disposalRequest)
+	if err != nil {
+		return "", err
+	}
+	return string(disposalRequestJSON), nil
+}
+
+func getDisposalRequest(ctx contractapi.TransactionContextInterface, requestId string) (DisposalRequest, error) {
+	requestBytes, err := ctx.GetStub().GetState(requestId)
+	if err != nil {
+		return DisposalRequest{}, fmt.Errorf("Failed to get disposal request %v: %v", requestId, err.Error())
+	}
+	if requestBytes == nil {
+		return DisposalRequest{}, fmt.Errorf("Record does not exist with ID: %v", requestId)
+	}
+
+	var disposalRequest DisposalRequest
+	err = json.Unmarshal(requestBytes, &disposalRequest)
+	if err != nil {
+		return DisposalRequest{}, err
+	}
+	if disposalRequest.DocType != DISPOSAL_REQUEST {
+		return DisposalRequest{}, fmt.Errorf("ID %v does not belong to a disposal request", requestId)
+	}
+	return disposalRequest, nil
+}
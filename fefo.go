@@ -0,0 +1,310 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+FefoOverride records a dispatch made against the first-expiry-first-out policy of the sender.
+*/
+type FefoOverride struct {
+	Id                string `json:"id"`
+	EntityId          string `json:"entityId"`
+	AssetId           string `json:"assetId"`
+	ProductId         string `json:"productId"`
+	ManufacturerId    string `json:"manufacturerId"`
+	ExpiryDate        int64  `json:"expiryDate"`
+	EarlierAssetId    string `json:"earlierAssetId"`
+	EarlierExpiryDate int64  `json:"earlierExpiryDate"`
+	Reason            string `json:"reason"`
+	DocType           string `json:"docType"`
+}
+
+type PickListItem struct {
+	AssetId    string `json:"assetId"`
+	CartonId   string `json:"cartonId"`
+	BatchId    string `json:"batchId"`
+	LotNumber  string `json:"lotNumber"`
+	ExpiryDate int64  `json:"expiryDate"`
+}
+
+type PickList struct {
+	ProductId         string         `json:"productId"`
+	ManufacturerId    string         `json:"manufacturerId"`
+	RequestedQuantity int            `json:"requestedQuantity"`
+	Shortfall         int            `json:"shortfall"`
+	Items             []PickListItem `json:"items"`
+}
+
+/* Asset statuses in which stock can be dispatched by its holder */
+var dispatchableStatuses = []string{
+	vaccinechainhelper.Statuses.ReadyForDistribution,
+	vaccinechainhelper.Statuses.ReceivedAtDistributor,
+	vaccinechainhelper.Statuses.ChemistInventoryReceived,
+}
+
+/*
+SetFefoPolicy enables or disables first-expiry-first-out dispatch for the logged-in entity.
+The Vaccine Chain Admin can set the policy of any entity.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param policyInputString: JSON string with the policy details
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) SetFefoPolicy(ctx contractapi.TransactionContextInterface, policyInputString string) error {
+	policyInput := struct {
+		EntityId string `json:"entityId"`
+		DocType  string `json:"docType" validate:"omitempty,oneof=MANUFACTURER DISTRIBUTER CHEMIST HOSPITAL CLINIC"`
+		Enabled  bool   `json:"enabled"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(policyInputString), &policyInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for FEFO policy: %v", err.Error())
+	}
+	fmt.Println("Input String:", policyInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(policyInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* The admin sets the policy of the given entity, other entities set their own */
+	entityId, docType := entityDetails.Id, role
+	if role == vaccinechainhelper.VACCINE_CHAIN_ADMIN {
+		if policyInput.EntityId == "" || policyInput.DocType == "" {
+			return fmt.Errorf("Entity ID and type are required to set the policy of another entity")
+		}
+		entityId, docType = policyInput.EntityId, policyInput.DocType
+	} else if role != vaccinechainhelper.MANUFACTURER && role != vaccinechainhelper.DISTRIBUTER && !isDispensingRole(role) {
+		return fmt.Errorf("FEFO policy only applies to entities holding inventory")
+	}
+
+	entityBytes, err := vaccinechainhelper.IsExist(ctx, entityId, docType)
+	if err != nil {
+		return err
+	}
+	if entityBytes == nil {
+		return fmt.Errorf("Record does not exist with ID: %v", entityId)
+	}
+
+	var entity Entity
+	err = json.Unmarshal(entityBytes, &entity)
+	if err != nil {
+		return fmt.Errorf("Failed to convert entity details: %v", err.Error())
+	}
+
+	entity.FefoEnabled = policyInput.Enabled
+	err = insertData(ctx, entity, entityId, docType)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Set FEFO Policy Function ******************")
+	return nil
+}
+
+/*
+GetPickList suggests which assets of a product the logged-in entity should dispatch for a requested quantity
+of packets, earliest expiry first. Expired stock is left out.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param pickListInputString: JSON string with the product and the requested quantity
+
+@returns string: Returns the JSON-encoded pick list
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetPickList(ctx contractapi.TransactionContextInterface, pickListInputString string) (string, error) {
+	pickListInput := struct {
+		ProductId      string `json:"productId" validate:"required"`
+		ManufacturerId string `json:"manufacturerId" validate:"required"`
+		Quantity       int    `json:"quantity" validate:"required,gt=0"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(pickListInputString), &pickListInput)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the input string for pick list: %v", err.Error())
+	}
+	fmt.Println("Input String:", pickListInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(pickListInput)
+	if err != nil {
+		return "", err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, _, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	assets, err := getDispatchableAssets(ctx, entityDetails.Id, pickListInput.ProductId, pickListInput.ManufacturerId, timestamp.Unix(), 0)
+	if err != nil {
+		return "", err
+	}
+
+	pickList := PickList{
+		ProductId:         pickListInput.ProductId,
+		ManufacturerId:    pickListInput.ManufacturerId,
+		RequestedQuantity: pickListInput.Quantity,
+		Items:             []PickListItem{},
+	}
+	for _, asset := range assets {
+		if len(pickList.Items) == pickListInput.Quantity {
+			break
+		}
+		pickList.Items = append(pickList.Items, PickListItem{
+			AssetId:    asset.Id,
+			CartonId:   asset.CartonId,
+			BatchId:    asset.BatchId,
+			LotNumber:  asset.LotNumber,
+			ExpiryDate: asset.ExpiryDate,
+		})
+	}
+	pickList.Shortfall = pickListInput.Quantity - len(pickList.Items)
+
+	pickListJSON, err := json.Marshal(pickList)
+	if err != nil {
+		return "", err
+	}
+	return string(pickListJSON), nil
+}
+
+/*
+checkFefo refuses the dispatch of an asset when the sender enforces first-expiry-first-out and still holds
+unexpired stock of the same product expiring earlier. With an override reason the dispatch goes ahead
+and the override is recorded.
+*/
+func checkFefo(ctx contractapi.TransactionContextInterface, sender Entity, shippedAsset Asset, overrideReason string) error {
+	if !sender.FefoEnabled {
+		return nil
+	}
+
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	earlierAssets, err := getDispatchableAssets(ctx, sender.Id, shippedAsset.ProductId, shippedAsset.ManufacturerId, timestamp.Unix(), shippedAsset.ExpiryDate)
+	if err != nil {
+		return err
+	}
+	if len(earlierAssets) == 0 {
+		return nil
+	}
+
+	earliest := earlierAssets[0]
+	if overrideReason == "" {
+		return fmt.Errorf("FEFO policy requires asset %v expiring on %v to be dispatched first", earliest.Id, earliest.ExpiryDate)
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	override := FefoOverride{
+		Id:                txID,
+		EntityId:          sender.Id,
+		AssetId:           shippedAsset.Id,
+		ProductId:         shippedAsset.ProductId,
+		ManufacturerId:    shippedAsset.ManufacturerId,
+		ExpiryDate:        shippedAsset.ExpiryDate,
+		EarlierAssetId:    earliest.Id,
+		EarlierExpiryDate: earliest.ExpiryDate,
+		Reason:            overrideReason,
+		DocType:           FEFO_OVERRIDE,
+	}
+	return insertData(ctx, override, txID, FEFO_OVERRIDE)
+}
+
+/*
+getDispatchableAssets returns the unexpired assets of a product an owner can dispatch, earliest expiry first.
+Assets of batches that are not released, or have been put on hold, rejected or suspended, are left out.
+If expiringBefore is set, only assets expiring before that date are returned.
+*/
+func getDispatchableAssets(ctx contractapi.TransactionContextInterface, ownerId string, productId string, manufacturerId string, asOf int64, expiringBefore int64) ([]Asset, error) {
+	expiryDate := map[string]interface{}{"$gt": asOf}
+	if expiringBefore != 0 {
+		expiryDate["$lt"] = expiringBefore
+	}
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType":        vaccinechainhelper.ASSET,
+			"owner":          ownerId,
+			"productId":      productId,
+			"manufacturerId": manufacturerId,
+			"expiryDate":     expiryDate,
+			"status":         map[string]interface{}{"$in": dispatchableStatuses},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("queryString:", string(queryBytes))
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	assets := []Asset{}
+	releasedBatches := make(map[string]bool)
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var asset Asset
+		err = json.Unmarshal(queryResult.Value, &asset)
+		if err != nil {
+			return nil, err
+		}
+
+		/* Skips the assets of batches that cannot be shipped */
+		released, ok := releasedBatches[asset.BatchId]
+		if !ok {
+			batchDetails, err := getBatch(ctx, asset.ManufacturerId, asset.BatchId)
+			if err != nil {
+				return nil, err
+			}
+			released = batchDetails.ReleaseStatus == ReleaseStatuses.Released && !batchDetails.Suspended
+			releasedBatches[asset.BatchId] = released
+		}
+		if !released {
+			continue
+		}
+		assets = append(assets, asset)
+	}
+
+	sort.Slice(assets, func(i, j int) bool {
+		if assets[i].ExpiryDate != assets[j].ExpiryDate {
+			return assets[i].ExpiryDate < assets[j].ExpiryDate
+		}
+		return assets[i].Id < assets[j].Id
+	})
+	return assets, nil
+}
@@ -0,0 +1,392 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type Incident struct {
+	Id             string   `json:"id"`
+	Category       string   `json:"category"`
+	AssetIds       []string `json:"assetIds"`
+	CartonId       string   `json:"cartonId,omitempty"`
+	Description    string   `json:"description"`
+	IncidentDate   int64    `json:"incidentDate"`
+	ReportedBy     string   `json:"reportedBy"`
+	Status         string   `json:"status"`
+	Remarks        string   `json:"remarks,omitempty"`
+	ResolvedBy     string   `json:"resolvedBy,omitempty"`
+	ResolutionDate int64    `json:"resolutionDate,omitempty"`
+	DocType        string   `json:"docType"`
+}
+
+/*
+IncidentAlert records an attempt to move a packet that was reported lost or stolen.
+*/
+type IncidentAlert struct {
+	Id          string `json:"id"`
+	IncidentId  string `json:"incidentId"`
+	PacketId    string `json:"packetId"`
+	Category    string `json:"category"`
+	AttemptedBy string `json:"attemptedBy"`
+	Function    string `json:"function"`
+	AlertDate   int64  `json:"alertDate"`
+	DocType     string `json:"docType"`
+}
+
+/* ShipmentRejection is returned instead of shipping a packet reported lost or stolen */
+type ShipmentRejection struct {
+	Rejected   bool   `json:"rejected"`
+	Reason     string `json:"reason"`
+	PacketId   string `json:"packetId"`
+	IncidentId string `json:"incidentId"`
+	AlertId    string `json:"alertId"`
+}
+
+/*
+ReportIncident records that assets were lost, stolen, damaged or tampered with, and freezes them so that they
+can no longer be shipped, sold or administered. Assets are listed individually or as a whole carton.
+It is called by the current owner of the assets, their manufacturer or the Regulator.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param incidentInputString: JSON string with the incident details
+
+@returns string: Returns the ID of the incident
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) ReportIncident(ctx contractapi.TransactionContextInterface, incidentInputString string) (string, error) {
+	incidentInput := struct {
+		AssetIds     []string `json:"assetIds" validate:"required_without=CartonId,dive,required"`
+		CartonId     string   `json:"cartonId" validate:"required_without=AssetIds"`
+		Category     string   `json:"category" validate:"required,oneof=LOST STOLEN DAMAGED TAMPERED"`
+		Description  string   `json:"description" validate:"required"`
+		IncidentDate int64    `json:"incidentDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(incidentInputString), &incidentInput)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the input string for incident: %v", err.Error())
+	}
+	fmt.Println("Input String:", incidentInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(incidentInput)
+	if err != nil {
+		return "", err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	reporterDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is allowed to report incidents */
+	if role != vaccinechainhelper.MANUFACTURER && role != vaccinechainhelper.DISTRIBUTER &&
+		!isDispensingRole(role) && role != REGULATOR {
+		return "", fmt.Errorf("You are not authorized to report incidents")
+	}
+
+	/* Collects the listed assets and the packets of the carton */
+	assetIds := incidentInput.AssetIds
+	if incidentInput.CartonId != "" {
+		cartonAssetIds, err := getCartonAssetIds(ctx, incidentInput.CartonId)
+		if err != nil {
+			return "", err
+		}
+		assetIds = append(assetIds, cartonAssetIds...)
+	}
+	if len(assetIds) == 0 {
+		return "", fmt.Errorf("No assets found for carton %v", incidentInput.CartonId)
+	}
+
+	txID := ctx.GetStub().GetTxID()
+
+	/* Freezes every affected asset */
+	frozen := make(map[string]bool)
+	var frozenIds []string
+	for _, assetId := range assetIds {
+		if frozen[assetId] {
+			continue
+		}
+		frozen[assetId] = true
+
+		asset, err := getAsset(ctx, assetId)
+		if err != nil {
+			return "", err
+		}
+		if role != REGULATOR && asset.Owner != reporterDetails.Id && asset.ManufacturerId != reporterDetails.Id {
+			return "", fmt.Errorf("You are not authorized to report an incident on asset %v", asset.Id)
+		}
+		if blockedAssetStatuses[asset.Status] || asset.Status == AssetStatuses.Administered ||
+			asset.Status == vaccinechainhelper.Statuses.SoldToCustomer {
+			return "", fmt.Errorf("Asset %v in status %v cannot be frozen", asset.Id, asset.Status)
+		}
+
+		asset.PreviousStatus = asset.Status
+		asset.Status = AssetStatuses.Frozen
+		asset.IncidentId = txID
+		err = insertData(ctx, asset, asset.Id, "")
+		if err != nil {
+			return "", err
+		}
+		frozenIds = append(frozenIds, asset.Id)
+	}
+
+	incident := Incident{
+		Id:           txID,
+		Category:     incidentInput.Category,
+		AssetIds:     frozenIds,
+		CartonId:     incidentInput.CartonId,
+		Description:  incidentInput.Description,
+		IncidentDate: incidentInput.IncidentDate,
+		ReportedBy:   reporterDetails.Id,
+		Status:       IncidentStatuses.Open,
+		DocType:      INCIDENT,
+	}
+
+	/* Inserts the incident into the ledger */
+	err = insertData(ctx, incident, txID, "")
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("********** End of Report Incident Function ******************")
+	return txID, nil
+}
+
+/*
+ResolveIncident closes an open incident. Recovered assets return to the status they had before being frozen, unless
+their owner has been suspended meanwhile, in which case they stay frozen with the rest of its inventory until it is
+reinstated or the inventory transferred, while written-off assets are permanently taken out of the inventory.
+It is called by the Vaccine Chain Admin or the Regulator.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param resolveInputString: JSON string with the incident and its resolution
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) ResolveIncident(ctx contractapi.TransactionContextInterface, resolveInputString string) error {
+	resolveInput := struct {
+		IncidentId     string `json:"incidentId" validate:"required"`
+		Resolution     string `json:"resolution" validate:"required,oneof=RECOVERED WRITTEN_OFF"`
+		Remarks        string `json:"remarks"`
+		ResolutionDate int64  `json:"resolutionDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(resolveInputString), &resolveInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for incident resolution: %v", err.Error())
+	}
+	fmt.Println("Input String:", resolveInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(resolveInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is allowed to resolve incidents */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN && role != REGULATOR {
+		return fmt.Errorf("Only the Vaccine Chain Admin and the Regulator are allowed to resolve incidents")
+	}
+
+	incident, err := getIncident(ctx, resolveInput.IncidentId)
+	if err != nil {
+		return err
+	}
+	if incident.Status != IncidentStatuses.Open {
+		return fmt.Errorf("Incident %v is already %v", incident.Id, incident.Status)
+	}
+
+	/* Releases or writes off every frozen asset of the incident */
+	for _, assetId := range incident.AssetIds {
+		asset, err := getAsset(ctx, assetId)
+		if err != nil {
+			return err
+		}
+		if asset.Status != AssetStatuses.Frozen || asset.IncidentId != incident.Id {
+			continue
+		}
+
+		if resolveInput.Resolution == IncidentStatuses.Recovered {
+			/* Hands the asset over to the suspension of its owner, if any */
+			ownerSuspended, err := isEntitySuspended(ctx, asset.Owner)
+			if err != nil {
+				return err
+			}
+			if ownerSuspended {
+				asset.SuspensionRef = ctx.GetStub().GetTxID()
+			} else {
+				asset.Status = asset.PreviousStatus
+				asset.PreviousStatus = ""
+			}
+		} else {
+			asset.Status = AssetStatuses.WrittenOff
+			asset.PreviousStatus = ""
+		}
+		err = insertData(ctx, asset, asset.Id, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	incident.Status = resolveInput.Resolution
+	incident.Remarks = resolveInput.Remarks
+	incident.ResolvedBy = entityDetails.Id
+	incident.ResolutionDate = resolveInput.ResolutionDate
+	err = insertData(ctx, incident, incident.Id, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Resolve Incident Function ******************")
+	return nil
+}
+
+/*
+ViewIncident retrieves an incident. It is called by the reporting entity, the Vaccine Chain Admin or the Regulator.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param incidentId: ID of the incident
+
+@returns string: Returns the JSON-encoded incident
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) ViewIncident(ctx contractapi.TransactionContextInterface, incidentId string) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	incident, err := getIncident(ctx, incidentId)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user is allowed to view the incident */
+	if incident.ReportedBy != entityDetails.Id && role != vaccinechainhelper.VACCINE_CHAIN_ADMIN && role != REGULATOR {
+		return "", fmt.Errorf("You are not authorized to view incident %v", incidentId)
+	}
+
+	incidentJSON, err := json.Marshal(incident)
+	if err != nil {
+		return "", err
+	}
+	return string(incidentJSON), nil
+}
+
+/*
+raiseIncidentAlert checks whether a packet about to be shipped was reported lost or stolen. If so, the attempt is
+recorded, the "Incident Alert" event is emitted and the JSON-encoded rejection is returned, so that the caller stops
+the shipment and hands the rejection to the client without failing the transaction, which would discard the alert.
+An empty string is returned for a packet that can be shipped.
+*/
+func raiseIncidentAlert(ctx contractapi.TransactionContextInterface, packetId string, attemptedBy string, function string) (string, error) {
+	assetBytes, err := ctx.GetStub().GetState(packetId)
+	if err != nil {
+		return "", fmt.Errorf("failed to get asset %s: %v", packetId, err)
+	}
+	if assetBytes == nil {
+		return "", nil
+	}
+
+	var asset Asset
+	err = json.Unmarshal(assetBytes, &asset)
+	if err != nil {
+		return "", err
+	}
+	if asset.Status != AssetStatuses.Frozen || asset.IncidentId == "" {
+		return "", nil
+	}
+
+	incident, err := getIncident(ctx, asset.IncidentId)
+	if err != nil {
+		return "", err
+	}
+	if incident.Category != "LOST" && incident.Category != "STOLEN" {
+		return "", nil
+	}
+
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	alert := IncidentAlert{
+		Id:          txID,
+		IncidentId:  incident.Id,
+		PacketId:    asset.Id,
+		Category:    incident.Category,
+		AttemptedBy: attemptedBy,
+		Function:    function,
+		AlertDate:   timestamp.Unix(),
+		DocType:     INCIDENT_ALERT,
+	}
+
+	/* Inserts the alert into the ledger */
+	err = insertData(ctx, alert, txID, "")
+	if err != nil {
+		return "", err
+	}
+
+	alertJSON, err := json.Marshal(alert)
+	if err != nil {
+		return "", err
+	}
+	err = ctx.GetStub().SetEvent("Incident Alert", alertJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to setEvent Incident Alert: %v", err.Error())
+	}
+
+	rejection := ShipmentRejection{
+		Rejected:   true,
+		Reason:     fmt.Sprintf("Packet %v was reported %v and cannot be shipped", asset.Id, incident.Category),
+		PacketId:   asset.Id,
+		IncidentId: incident.Id,
+		AlertId:    txID,
+	}
+	rejectionJSON, err := json.Marshal(rejection)
+	if err != nil {
+		return "", err
+	}
+	return string(rejectionJSON), nil
+}
+
+func getIncident(ctx contractapi.TransactionContextInterface, incidentId string) (Incident, error) {
+	incidentBytes, err := ctx.GetStub().GetState(incidentId)
+	if err != nil {
+		return Incident{}, fmt.Errorf("Failed to get incident %v: %v", incidentId, err.Error())
+	}
+	if incidentBytes == nil {
+		return Incident{}, fmt.Errorf("Record does not exist with ID: %v", incidentId)
+	}
+
+	var incident Incident
+	err = json.Unmarshal(incidentBytes, &incident)
+	if err != nil {
+		return Incident{}, err
+	}
+	if incident.DocType != INCIDENT {
+		return Incident{}, fmt.Errorf("ID %v does not belong to an incident", incidentId)
+	}
+	return incident, nil
+}
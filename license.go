@@ -0,0 +1,247 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+LicenseRenewal records the renewal of the licence of an entity, along with the expiry date it replaced.
+*/
+type LicenseRenewal struct {
+	Id                 string `json:"id"`
+	EntityId           string `json:"entityId"`
+	EntityType         string `json:"entityType"`
+	LicenseNo          string `json:"licenseNo"`
+	LicenseAuthority   string `json:"licenseAuthority"`
+	LicenseIssueDate   int64  `json:"licenseIssueDate"`
+	LicenseExpiryDate  int64  `json:"licenseExpiryDate"`
+	PreviousExpiryDate int64  `json:"previousExpiryDate,omitempty"`
+	RenewedBy          string `json:"renewedBy"`
+	DocType            string `json:"docType"`
+}
+
+type ExpiringLicense struct {
+	EntityId          string `json:"entityId"`
+	EntityType        string `json:"entityType"`
+	Name              string `json:"name"`
+	LicenseNo         string `json:"licenseNo"`
+	LicenseAuthority  string `json:"licenseAuthority"`
+	LicenseExpiryDate int64  `json:"licenseExpiryDate"`
+	Expired           bool   `json:"expired"`
+}
+
+/* Entity types holding a licence */
+var licensedEntityTypes = []string{
+	vaccinechainhelper.MANUFACTURER,
+	vaccinechainhelper.DISTRIBUTER,
+	vaccinechainhelper.CHEMIST,
+	HOSPITAL,
+	CLINIC,
+	WASTE_HANDLER,
+	LOGISTICS,
+}
+
+/*
+RenewLicense records a new licence period for an entity, which lifts the inactivity caused by an expired licence.
+It is exclusively called by the Vaccine Chain Admin.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param renewalInputString: JSON string with the entity and the new licence details
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) RenewLicense(ctx contractapi.TransactionContextInterface, renewalInputString string) error {
+	renewalInput := struct {
+		Id                string `json:"id" validate:"required"`
+		DocType           string `json:"docType" validate:"required,oneof=MANUFACTURER DISTRIBUTER CHEMIST HOSPITAL CLINIC WASTE_HANDLER LOGISTICS"`
+		LicenseNo         string `json:"licenseNo"`
+		LicenseAuthority  string `json:"licenseAuthority" validate:"required"`
+		LicenseIssueDate  int64  `json:"licenseIssueDate" validate:"required"`
+		LicenseExpiryDate int64  `json:"licenseExpiryDate" validate:"required,gtfield=LicenseIssueDate"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(renewalInputString), &renewalInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for licence renewal: %v", err.Error())
+	}
+	fmt.Println("Input String:", renewalInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(renewalInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	adminDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is that of a vaccine chain admin */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN {
+		return fmt.Errorf("Only the Vaccine Chain Admin is allowed to renew licences")
+	}
+
+	entityBytes, err := vaccinechainhelper.IsExist(ctx, renewalInput.Id, renewalInput.DocType)
+	if err != nil {
+		return err
+	}
+	if entityBytes == nil {
+		return fmt.Errorf("Record does not exist with ID: %v", renewalInput.Id)
+	}
+
+	var entity Entity
+	err = json.Unmarshal(entityBytes, &entity)
+	if err != nil {
+		return fmt.Errorf("Failed to convert entity details: %v", err.Error())
+	}
+	if renewalInput.LicenseExpiryDate <= entity.LicenseExpiryDate {
+		return fmt.Errorf("New licence expiry must be later than the current expiry %v", entity.LicenseExpiryDate)
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	renewal := LicenseRenewal{
+		Id:                 txID,
+		EntityId:           entity.Id,
+		EntityType:         renewalInput.DocType,
+		LicenseNo:          entity.LicenseNo,
+		LicenseAuthority:   renewalInput.LicenseAuthority,
+		LicenseIssueDate:   renewalInput.LicenseIssueDate,
+		LicenseExpiryDate:  renewalInput.LicenseExpiryDate,
+		PreviousExpiryDate: entity.LicenseExpiryDate,
+		RenewedBy:          adminDetails.Id,
+		DocType:            LICENSE_RENEWAL,
+	}
+	if renewalInput.LicenseNo != "" {
+		renewal.LicenseNo = renewalInput.LicenseNo
+	}
+
+	/* Updates the licence of the entity */
+	entity.LicenseNo = renewal.LicenseNo
+	entity.LicenseAuthority = renewal.LicenseAuthority
+	entity.LicenseIssueDate = renewal.LicenseIssueDate
+	entity.LicenseExpiryDate = renewal.LicenseExpiryDate
+	err = insertData(ctx, entity, entity.Id, renewalInput.DocType)
+	if err != nil {
+		return err
+	}
+
+	/* Inserts the renewal into the ledger */
+	err = insertData(ctx, renewal, txID, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Renew License Function ******************")
+	return nil
+}
+
+/*
+GetExpiringLicenses lists the licences expiring within the given number of days, along with those already expired,
+earliest expiry first. It is called by the Vaccine Chain Admin or the Regulator.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param days: Number of days ahead to look for expiring licences
+
+@returns string: Returns the JSON-encoded list of expiring licences
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetExpiringLicenses(ctx contractapi.TransactionContextInterface, days int) (string, error) {
+	if days < 0 {
+		return "", fmt.Errorf("Number of days cannot be negative")
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	_, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is allowed to view the licences */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN && role != REGULATOR {
+		return "", fmt.Errorf("Only the Vaccine Chain Admin and the Regulator are allowed to view expiring licences")
+	}
+
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	asOf := timestamp.Unix()
+
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType":           map[string]interface{}{"$in": licensedEntityTypes},
+			"licenseExpiryDate": map[string]interface{}{"$gt": 0, "$lte": asOf + int64(days)*86400},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("queryString:", string(queryBytes))
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(string(queryBytes))
+	if err != nil {
+		return "", err
+	}
+	defer resultsIterator.Close()
+
+	licenses := []ExpiringLicense{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return "", err
+		}
+
+		var entity Entity
+		err = json.Unmarshal(queryResult.Value, &entity)
+		if err != nil {
+			return "", err
+		}
+		licenses = append(licenses, ExpiringLicense{
+			EntityId:          entity.Id,
+			EntityType:        entity.DocType,
+			Name:              entity.Name,
+			LicenseNo:         entity.LicenseNo,
+			LicenseAuthority:  entity.LicenseAuthority,
+			LicenseExpiryDate: entity.LicenseExpiryDate,
+			Expired:           entity.LicenseExpiryDate <= asOf,
+		})
+	}
+
+	sort.SliceStable(licenses, func(i, j int) bool {
+		return licenses[i].LicenseExpiryDate < licenses[j].LicenseExpiryDate
+	})
+
+	licensesJSON, err := json.Marshal(licenses)
+	if err != nil {
+		return "", err
+	}
+	return string(licensesJSON), nil
+}
+
+/* checkLicenseValid refuses an entity whose licence has expired. Entities registered without an expiry date pass. */
+func checkLicenseValid(ctx contractapi.TransactionContextInterface, entity Entity) error {
+	if entity.LicenseExpiryDate == 0 {
+		return nil
+	}
+
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if timestamp.Unix() >= entity.LicenseExpiryDate {
+		return fmt.Errorf("Licence of %v expired on %v", entity.Id, entity.LicenseExpiryDate)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+Location is a physical site, such as a warehouse or a cold room, operated by an entity under its licence.
+*/
+type Location struct {
+	Id       string `json:"id"`
+	EntityId string `json:"entityId"`
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	Type     string `json:"type"`
+	DocType  string `json:"docType"`
+}
+
+/*
+RegisterLocation registers a location of the logged-in entity. It is called by the Manufacturer, the Distributor,
+the Chemist, the Hospital or the Clinic.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param locationInputString: JSON string with the location details
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) RegisterLocation(ctx contractapi.TransactionContextInterface, locationInputString string) error {
+	locationInput := struct {
+		Id      string `json:"id" validate:"required"`
+		Name    string `json:"name" validate:"required"`
+		Address string `json:"address" validate:"required"`
+		Type    string `json:"type" validate:"required,oneof=WAREHOUSE COLD_ROOM STORE"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(locationInputString), &locationInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for location: %v", err.Error())
+	}
+	fmt.Println("Input String:", locationInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(locationInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is allowed to hold inventory */
+	if role != vaccinechainhelper.MANUFACTURER && role != vaccinechainhelper.DISTRIBUTER && !isDispensingRole(role) {
+		return fmt.Errorf("Only entities holding inventory are allowed to register locations")
+	}
+
+	/* Checks if the location already exists */
+	locationBytes, err := vaccinechainhelper.IsExist(ctx, locationInput.Id, LOCATION)
+	if err != nil {
+		return err
+	}
+	if locationBytes != nil {
+		return fmt.Errorf("Location already exists with ID: %v", locationInput.Id)
+	}
+
+	location := Location{
+		Id:       locationInput.Id,
+		EntityId: entityDetails.Id,
+		Name:     locationInput.Name,
+		Address:  locationInput.Address,
+		Type:     locationInput.Type,
+		DocType:  LOCATION,
+	}
+
+	/* Inserts the location into the ledger */
+	err = insertData(ctx, location, location.Id, LOCATION)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Register Location Function ******************")
+	return nil
+}
+
+/*
+GetLocations lists the locations registered by the logged-in entity.
+
+@param ctx: TransactionContextInterface for the smart contract
+
+@returns string: Returns the JSON-encoded list of locations
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetLocations(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, _, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"docType":"%s","entityId":"%s"}}`, LOCATION, entityDetails.Id)
+	fmt.Println("queryString:", queryString)
+
+	return getQueryResultForQueryString(ctx, queryString)
+}
+
+/*
+MoveAssets moves assets held by the logged-in entity from one of its locations to another, without any change
+of ownership. Assets are listed individually or as a whole carton.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param moveInputString: JSON string with the assets and the destination location
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) MoveAssets(ctx contractapi.TransactionContextInterface, moveInputString string) error {
+	moveInput := struct {
+		AssetIds   []string `json:"assetIds" validate:"required_without=CartonId,dive,required"`
+		CartonId   string   `json:"cartonId" validate:"required_without=AssetIds"`
+		LocationId string   `json:"locationId" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(moveInputString), &moveInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for asset move: %v", err.Error())
+	}
+	fmt.Println("Input String:", moveInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(moveInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, _, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks that the destination location belongs to the logged-in entity */
+	err = checkDestinationLocation(ctx, moveInput.LocationId, entityDetails.Id)
+	if err != nil {
+		return err
+	}
+
+	/* Collects the listed assets and the packets of the carton */
+	assetIds := moveInput.AssetIds
+	if moveInput.CartonId != "" {
+		cartonAssetIds, err := getCartonAssetIds(ctx, moveInput.CartonId)
+		if err != nil {
+			return err
+		}
+		assetIds = append(assetIds, cartonAssetIds...)
+	}
+	if len(assetIds) == 0 {
+		return fmt.Errorf("No assets found for carton %v", moveInput.CartonId)
+	}
+
+	/* Moves every asset to the destination location */
+	moved := make(map[string]bool)
+	for _, assetId := range assetIds {
+		if moved[assetId] {
+			continue
+		}
+		moved[assetId] = true
+
+		asset, err := getAsset(ctx, assetId)
+		if err != nil {
+			return err
+		}
+		if asset.Owner != entityDetails.Id {
+			return fmt.Errorf("Asset %v is not held by %v", asset.Id, entityDetails.Id)
+		}
+		if asset.Status == AssetStatuses.Destroyed || asset.Status == AssetStatuses.WrittenOff {
+			return fmt.Errorf("Asset %v is %v and cannot be moved", asset.Id, asset.Status)
+		}
+		if asset.LocationId == moveInput.LocationId {
+			continue
+		}
+
+		asset.LocationId = moveInput.LocationId
+		err = insertData(ctx, asset, asset.Id, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("********** End of Move Assets Function ******************")
+	return nil
+}
+
+/*
+GetStockByLocation reports the stock held by the logged-in entity, split by the location the assets are kept at.
+Assets not yet placed at a location are reported without one.
+
+@param ctx: TransactionContextInterface for the smart contract
+
+@returns string: Returns the JSON-encoded stock-on-hand report
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetStockByLocation(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, _, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return getStockReport(ctx, entityDetails.Id, true)
+}
+
+/* checkDestinationLocation checks that a location, if given, is registered under the entity receiving the assets */
+func checkDestinationLocation(ctx contractapi.TransactionContextInterface, locationId string, entityId string) error {
+	if locationId == "" {
+		return nil
+	}
+
+	location, err := getLocation(ctx, locationId)
+	if err != nil {
+		return err
+	}
+	if location.EntityId != entityId {
+		return fmt.Errorf("Location %v is not registered under %v", locationId, entityId)
+	}
+	return nil
+}
+
+func getLocation(ctx contractapi.TransactionContextInterface, locationId string) (Location, error) {
+	locationBytes, err := vaccinechainhelper.IsExist(ctx, locationId, LOCATION)
+	if err != nil {
+		return Location{}, err
+	}
+	if locationBytes == nil {
+		return Location{}, fmt.Errorf("Record does not exist with ID: %v", locationId)
+	}
+
+	var location Location
+	err = json.Unmarshal(locationBytes, &location)
+	if err != nil {
+		return Location{}, fmt.Errorf("Failed to convert location details: %v", err.Error())
+	}
+	return location, nil
+}
@@ -0,0 +1,367 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type CustodyEvent struct {
+	Type       string `json:"type"`
+	Location   string `json:"location"`
+	EventDate  int64  `json:"eventDate"`
+	RecordedBy string `json:"recordedBy"`
+	TxId       string `json:"txId"`
+}
+
+/*
+Shipment records the physical transport of assets by a carrier. Custody events are kept apart from
+the legal ownership held in Asset.Owner.
+*/
+type Shipment struct {
+	Id            string         `json:"id"`
+	CarrierId     string         `json:"carrierId"`
+	SenderId      string         `json:"senderId"`
+	ReceiverId    string         `json:"receiverId"`
+	CartonId      string         `json:"cartonId,omitempty"`
+	AssetIds      []string       `json:"assetIds"`
+	Status        string         `json:"status"`
+	BookedDate    int64          `json:"bookedDate"`
+	CustodyEvents []CustodyEvent `json:"custodyEvents"`
+	DocType       string         `json:"docType"`
+}
+
+type CustodyRecord struct {
+	ShipmentId string `json:"shipmentId"`
+	CarrierId  string `json:"carrierId"`
+	Type       string `json:"type"`
+	Location   string `json:"location"`
+	EventDate  int64  `json:"eventDate"`
+	RecordedBy string `json:"recordedBy"`
+	TxId       string `json:"txId"`
+}
+
+/*
+BookShipment books a carrier to transport a carton or a list of packets from the logged-in entity to the receiver.
+It is called by the Manufacturer, Distributor, Chemist, Hospital or Clinic holding every asset of the shipment, so the
+shipment is booked before ownership passes to the receiver.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param shipmentInputString: JSON string with the shipment details
+
+@returns string: Returns the ID of the shipment
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) BookShipment(ctx contractapi.TransactionContextInterface, shipmentInputString string) (string, error) {
+	shipmentInput := struct {
+		CarrierId  string   `json:"carrierId" validate:"required"`
+		ReceiverId string   `json:"receiverId" validate:"required"`
+		CartonId   string   `json:"cartonId" validate:"required_without=PacketIds"`
+		PacketIds  []string `json:"packetIds" validate:"required_without=CartonId,dive,required"`
+		BookedDate int64    `json:"bookedDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(shipmentInputString), &shipmentInput)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the input string for shipment: %v", err.Error())
+	}
+	fmt.Println("Input String:", shipmentInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(shipmentInput)
+	if err != nil {
+		return "", err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	senderDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is that of a stock-holding entity */
+	if role != vaccinechainhelper.MANUFACTURER && role != vaccinechainhelper.DISTRIBUTER && !isDispensingRole(role) {
+		return "", fmt.Errorf("Only Manufacturers, Distributors, Chemists, Hospitals and Clinics are allowed to book shipments")
+	}
+
+	/* Checks if the carrier exists and is active */
+	_, _, err = getActiveEntity(ctx, shipmentInput.CarrierId, LOGISTICS)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks that the receiver is active, so that no stock is sent to a suspended entity */
+	err = checkReceiverActive(ctx, shipmentInput.ReceiverId)
+	if err != nil {
+		return "", err
+	}
+
+	/* Collects the listed packets and the packets of the carton */
+	assetIds := shipmentInput.PacketIds
+	if shipmentInput.CartonId != "" {
+		cartonAssetIds, err := getCartonAssetIds(ctx, shipmentInput.CartonId)
+		if err != nil {
+			return "", err
+		}
+		assetIds = append(assetIds, cartonAssetIds...)
+	}
+	if len(assetIds) == 0 {
+		return "", fmt.Errorf("No assets found for carton %v", shipmentInput.CartonId)
+	}
+
+	/* Checks that every asset is held by the sender */
+	for _, assetId := range assetIds {
+		asset, err := getAsset(ctx, assetId)
+		if err != nil {
+			return "", err
+		}
+		if asset.Owner != senderDetails.Id {
+			return "", fmt.Errorf("Asset %v is not held by %v", asset.Id, senderDetails.Id)
+		}
+		if blockedAssetStatuses[asset.Status] {
+			return "", fmt.Errorf("Asset %v is %v and cannot be shipped", asset.Id, asset.Status)
+		}
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	shipment := Shipment{
+		Id:            txID,
+		CarrierId:     shipmentInput.CarrierId,
+		SenderId:      senderDetails.Id,
+		ReceiverId:    shipmentInput.ReceiverId,
+		CartonId:      shipmentInput.CartonId,
+		AssetIds:      assetIds,
+		Status:        ShipmentStatuses.Booked,
+		BookedDate:    shipmentInput.BookedDate,
+		CustodyEvents: []CustodyEvent{},
+		DocType:       SHIPMENT,
+	}
+
+	/* Inserts the shipment into the ledger */
+	err = insertData(ctx, shipment, txID, "")
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("********** End of Book Shipment Function ******************")
+	return txID, nil
+}
+
+/*
+RecordCustodyEvent records a custody event on a shipment. It is exclusively called by the Logistics provider
+booked for the shipment. The pickup starts the transit, hub scans may follow, and the handover to the receiver
+completes the shipment. Pickup and handover are refused while the receiver is suspended.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param custodyInputString: JSON string with the custody event details
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) RecordCustodyEvent(ctx contractapi.TransactionContextInterface, custodyInputString string) error {
+	custodyInput := struct {
+		ShipmentId string `json:"shipmentId" validate:"required"`
+		Type       string `json:"type" validate:"required,oneof=PICKUP HUB_SCAN HANDOVER"`
+		Location   string `json:"location" validate:"required"`
+		EventDate  int64  `json:"eventDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(custodyInputString), &custodyInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for custody event: %v", err.Error())
+	}
+	fmt.Println("Input String:", custodyInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(custodyInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	carrierDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is that of a logistics provider */
+	if role != LOGISTICS {
+		return fmt.Errorf("Only Logistics providers are allowed to record custody events")
+	}
+
+	shipment, err := getShipment(ctx, custodyInput.ShipmentId)
+	if err != nil {
+		return err
+	}
+	if shipment.CarrierId != carrierDetails.Id {
+		return fmt.Errorf("Shipment %v is not booked with %v", shipment.Id, carrierDetails.Id)
+	}
+
+	/* Holds the shipment while its receiver is suspended; hub scans keep tracking it */
+	if custodyInput.Type != "HUB_SCAN" {
+		err = checkReceiverActive(ctx, shipment.ReceiverId)
+		if err != nil {
+			return err
+		}
+	}
+
+	/* Moves the shipment along its states */
+	switch custodyInput.Type {
+	case "PICKUP":
+		if shipment.Status != ShipmentStatuses.Booked {
+			return fmt.Errorf("Shipment %v has already been picked up", shipment.Id)
+		}
+		shipment.Status = ShipmentStatuses.InTransit
+	case "HUB_SCAN":
+		if shipment.Status != ShipmentStatuses.InTransit {
+			return fmt.Errorf("Shipment %v is not in transit", shipment.Id)
+		}
+	case "HANDOVER":
+		if shipment.Status != ShipmentStatuses.InTransit {
+			return fmt.Errorf("Shipment %v is not in transit", shipment.Id)
+		}
+		shipment.Status = ShipmentStatuses.Delivered
+	}
+
+	if len(shipment.CustodyEvents) > 0 && custodyInput.EventDate < shipment.CustodyEvents[len(shipment.CustodyEvents)-1].EventDate {
+		return fmt.Errorf("Custody event cannot be dated before the previous event of shipment %v", shipment.Id)
+	}
+
+	shipment.CustodyEvents = append(shipment.CustodyEvents, CustodyEvent{
+		Type:       custodyInput.Type,
+		Location:   custodyInput.Location,
+		EventDate:  custodyInput.EventDate,
+		RecordedBy: carrierDetails.Id,
+		TxId:       ctx.GetStub().GetTxID(),
+	})
+	err = insertData(ctx, shipment, shipment.Id, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Record Custody Event Function ******************")
+	return nil
+}
+
+/*
+GetShipments lists the shipments the logged-in entity is involved in as carrier, sender or receiver.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param status: Shipment status to filter on, or empty for all shipments
+
+@returns string: Returns the JSON-encoded list of shipments
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetShipments(ctx contractapi.TransactionContextInterface, status string) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, _, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	selector := map[string]interface{}{
+		"docType": SHIPMENT,
+		"$or": []map[string]interface{}{
+			{"carrierId": entityDetails.Id},
+			{"senderId": entityDetails.Id},
+			{"receiverId": entityDetails.Id},
+		},
+	}
+	if status != "" {
+		selector["status"] = status
+	}
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("queryString:", string(queryBytes))
+
+	return getQueryResultForQueryString(ctx, string(queryBytes))
+}
+
+/* getCustodyTimeline returns the custody events of every shipment carrying the asset, in date order */
+func getCustodyTimeline(ctx contractapi.TransactionContextInterface, assetId string) ([]CustodyRecord, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType":  SHIPMENT,
+			"assetIds": map[string]interface{}{"$elemMatch": map[string]interface{}{"$eq": assetId}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("queryString:", string(queryBytes))
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	custody := []CustodyRecord{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var shipment Shipment
+		err = json.Unmarshal(queryResult.Value, &shipment)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, custodyEvent := range shipment.CustodyEvents {
+			custody = append(custody, CustodyRecord{
+				ShipmentId: shipment.Id,
+				CarrierId:  shipment.CarrierId,
+				Type:       custodyEvent.Type,
+				Location:   custodyEvent.Location,
+				EventDate:  custodyEvent.EventDate,
+				RecordedBy: custodyEvent.RecordedBy,
+				TxId:       custodyEvent.TxId,
+			})
+		}
+	}
+
+	sort.SliceStable(custody, func(i, j int) bool {
+		return custody[i].EventDate < custody[j].EventDate
+	})
+	return custody, nil
+}
+
+/* checkReceiverActive checks that the receiver of a shipment is active under any of the stock holding types */
+func checkReceiverActive(ctx contractapi.TransactionContextInterface, receiverId string) error {
+	_, _, err := getActiveEntity(ctx, receiverId, vaccinechainhelper.MANUFACTURER, vaccinechainhelper.DISTRIBUTER,
+		vaccinechainhelper.CHEMIST, HOSPITAL, CLINIC)
+	return err
+}
+
+func getShipment(ctx contractapi.TransactionContextInterface, shipmentId string) (Shipment, error) {
+	shipmentBytes, err := ctx.GetStub().GetState(shipmentId)
+	if err != nil {
+		return Shipment{}, fmt.Errorf("Failed to get shipment %v: %v", shipmentId, err.Error())
+	}
+	if shipmentBytes == nil {
+		return Shipment{}, fmt.Errorf("Record does not exist with ID: %v", shipmentId)
+	}
+
+	var shipment Shipment
+	err = json.Unmarshal(shipmentBytes, &shipment)
+	if err != nil {
+		return Shipment{}, err
+	}
+	if shipment.DocType != SHIPMENT {
+		return Shipment{}, fmt.Errorf("ID %v does not belong to a shipment", shipmentId)
+	}
+	return shipment, nil
+}
@@ -0,0 +1,159 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* Key of the transient map entry carrying the patient identifier */
+const PATIENT_TRANSIENT_KEY = "patient"
+
+/*
+patientCollectionName returns the private data collection holding the patient identifiers, in clear, of an organization.
+The collections of the organizations of the network are generated with scripts/generate_collections_config.sh.
+*/
+func patientCollectionName(mspId string) string {
+	return mspId + "PatientCollection"
+}
+
+type Patient struct {
+	Id        string `json:"id"`
+	PatientId string `json:"patientId"`
+	Salt      string `json:"salt"`
+	ChemistId string `json:"chemistId"`
+	DocType   string `json:"docType"`
+}
+
+/*
+ErasePatientData purges the clear patient identifier from the patient collection to satisfy a data-protection request.
+It is called by the Chemist, Hospital or Clinic that recorded the patient. The salted hash on the public ledger can no longer
+be linked to the patient afterwards.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param patientRef: Salted hash recorded for the patient on the public ledger
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) ErasePatientData(ctx contractapi.TransactionContextInterface, patientRef string) error {
+
+	/* Validates the logged-in entity to ensure it is active */
+	chemistDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is that of a chemist, hospital or clinic */
+	if !isDispensingRole(role) {
+		return fmt.Errorf("Only Chemists, Hospitals and Clinics are allowed to erase patient data")
+	}
+
+	mspId, err := getCallerMspId(ctx)
+	if err != nil {
+		return err
+	}
+	collection := patientCollectionName(mspId)
+
+	/* Checks that the patient record is present in the collection and was recorded by the caller */
+	patientBytes, err := ctx.GetStub().GetPrivateData(collection, patientRef)
+	if err != nil {
+		return fmt.Errorf("Failed to get patient record for %v: %v", patientRef, err.Error())
+	}
+	if patientBytes == nil {
+		return fmt.Errorf("Patient record does not exist for %v", patientRef)
+	}
+
+	var patient Patient
+	err = json.Unmarshal(patientBytes, &patient)
+	if err != nil {
+		return fmt.Errorf("Failed to convert patient record: %v", err.Error())
+	}
+	if patient.ChemistId != chemistDetails.Id {
+		return fmt.Errorf("Patient record %v was not recorded by %v", patientRef, chemistDetails.Id)
+	}
+
+	/* Purges the patient record and its history from the collection */
+	err = ctx.GetStub().PurgePrivateData(collection, patientRef)
+	if err != nil {
+		return fmt.Errorf("Failed to purge patient record for %v: %v", patientRef, err.Error())
+	}
+
+	fmt.Println("********** End of Erase Patient Data Function ******************")
+	return nil
+}
+
+/*
+putTransientPatient reads the patient identifier and salt passed through the transient map, stores them
+in the patient collection of the caller's organization and returns the salted hash used to refer to the patient on the public ledger.
+*/
+func putTransientPatient(ctx contractapi.TransactionContextInterface, chemistId string) (string, error) {
+	patient, err := getTransientPatient(ctx)
+	if err != nil {
+		return "", err
+	}
+	patient.ChemistId = chemistId
+
+	mspId, err := getCallerMspId(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Inserts the patient details into the patient collection */
+	patientJSON, err := json.Marshal(patient)
+	if err != nil {
+		return "", fmt.Errorf("Failed to marshal patient details: %v", err.Error())
+	}
+	err = ctx.GetStub().PutPrivateData(patientCollectionName(mspId), patient.Id, patientJSON)
+	if err != nil {
+		return "", fmt.Errorf("Failed to insert patient details to collection: %v", err.Error())
+	}
+
+	return patient.Id, nil
+}
+
+/* getTransientPatient reads the patient identifier and salt passed through the transient map without storing them */
+func getTransientPatient(ctx contractapi.TransactionContextInterface) (Patient, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return Patient{}, fmt.Errorf("Failed to get transient data: %v", err.Error())
+	}
+
+	patientBytes, ok := transientMap[PATIENT_TRANSIENT_KEY]
+	if !ok {
+		return Patient{}, fmt.Errorf("Patient details must be passed in the transient map under the key %v", PATIENT_TRANSIENT_KEY)
+	}
+
+	patientInput := struct {
+		PatientId string `json:"patientId" validate:"required"`
+		Salt      string `json:"salt" validate:"required,min=16"`
+	}{}
+	err = json.Unmarshal(patientBytes, &patientInput)
+	if err != nil {
+		return Patient{}, fmt.Errorf("Failed to unmarshal the transient patient details: %v", err.Error())
+	}
+
+	err = validateInputParams(patientInput)
+	if err != nil {
+		return Patient{}, err
+	}
+
+	return Patient{
+		Id:        patientReference(patientInput.Salt, patientInput.PatientId),
+		PatientId: patientInput.PatientId,
+		Salt:      patientInput.Salt,
+		DocType:   PATIENT,
+	}, nil
+}
+
+/* patientReference returns the salted hash of a patient identifier */
+func patientReference(salt string, patientId string) string {
+	hash := sha256.Sum256([]byte(salt + patientId))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,232 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/* Key of the transient map entry carrying the commercial pricing of a transaction */
+const PRICING_TRANSIENT_KEY = "pricing"
+
+/*
+ReceiptPricing holds the commercial details of a receipt, credit/debit note or amendment.
+It is only stored in the private pricing collections of the supplier's and customer's organizations,
+while the public document carries the hash of it.
+*/
+type ReceiptPricing struct {
+	Id                  string `json:"id"`
+	PerUnitSellingPrice int16  `json:"perUnitSellingPrice"`
+	BillAmount          int16  `json:"billAmount"`
+	Salt                string `json:"salt"`
+	DocType             string `json:"docType"`
+}
+
+/*
+UpdateEntityMspId sets the MSP ID of the organization an entity belongs to, whose pricing collection receives the
+pricing of its receipts. It is used for entities registered before the MSP ID was recorded, or that moved to another
+organization, and is exclusively called by the Vaccine Chain Admin.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param mspInputString: JSON string with the entity and its MSP ID
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) UpdateEntityMspId(ctx contractapi.TransactionContextInterface, mspInputString string) error {
+	mspInput := struct {
+		Id      string `json:"id" validate:"required"`
+		DocType string `json:"docType" validate:"required,oneof=MANUFACTURER DISTRIBUTER CHEMIST HOSPITAL CLINIC WASTE_HANDLER LOGISTICS"`
+		MspId   string `json:"mspId" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(mspInputString), &mspInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for MSP ID update: %v", err.Error())
+	}
+	fmt.Println("Input String:", mspInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(mspInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	_, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is that of a vaccine chain admin */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN {
+		return fmt.Errorf("Only the Vaccine Chain Admin is allowed to update the MSP ID of an entity")
+	}
+
+	entityBytes, err := vaccinechainhelper.IsExist(ctx, mspInput.Id, mspInput.DocType)
+	if err != nil {
+		return err
+	}
+	if entityBytes == nil {
+		return fmt.Errorf("Record does not exist with ID: %v", mspInput.Id)
+	}
+
+	var entity Entity
+	err = json.Unmarshal(entityBytes, &entity)
+	if err != nil {
+		return fmt.Errorf("Failed to convert entity details: %v", err.Error())
+	}
+
+	/* Updates the MSP ID of the entity */
+	entity.MspId = mspInput.MspId
+	err = insertData(ctx, entity, entity.Id, mspInput.DocType)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Update Entity MSP ID Function ******************")
+	return nil
+}
+
+/*
+getTransientPricing reads the pricing passed through the transient map of the transaction.
+If required is false a missing entry yields empty pricing instead of an error. The salt is required
+so that the price cannot be recovered from the hash recorded on the public document.
+*/
+func getTransientPricing(ctx contractapi.TransactionContextInterface, required bool) (ReceiptPricing, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return ReceiptPricing{}, fmt.Errorf("Failed to get transient data: %v", err.Error())
+	}
+
+	pricingBytes, ok := transientMap[PRICING_TRANSIENT_KEY]
+	if !ok {
+		if required {
+			return ReceiptPricing{}, fmt.Errorf("Pricing must be passed in the transient map under the key %v", PRICING_TRANSIENT_KEY)
+		}
+		return ReceiptPricing{}, nil
+	}
+
+	pricingInput := struct {
+		PerUnitSellingPrice int16  `json:"perUnitSellingPrice" validate:"gte=0"`
+		BillAmount          int16  `json:"billAmount" validate:"gte=0"`
+		Salt                string `json:"salt" validate:"required,min=16"`
+	}{}
+	err = json.Unmarshal(pricingBytes, &pricingInput)
+	if err != nil {
+		return ReceiptPricing{}, fmt.Errorf("Failed to unmarshal the transient pricing: %v", err.Error())
+	}
+
+	err = validateInputParams(pricingInput)
+	if err != nil {
+		return ReceiptPricing{}, err
+	}
+
+	return ReceiptPricing{
+		PerUnitSellingPrice: pricingInput.PerUnitSellingPrice,
+		BillAmount:          pricingInput.BillAmount,
+		Salt:                pricingInput.Salt,
+		DocType:             RECEIPT_PRICING,
+	}, nil
+}
+
+/*
+pricingCollectionName returns the private data collection holding the pricing of an organization. The collections
+of the organizations of the network are generated with scripts/generate_collections_config.sh.
+*/
+func pricingCollectionName(mspId string) string {
+	return mspId + "PricingCollection"
+}
+
+func getCallerMspId(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspId, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get MSP ID of the caller: %v", err.Error())
+	}
+	return mspId, nil
+}
+
+/*
+putReceiptPricing writes the pricing into the pricing collection of every given organization
+and returns the hash to be recorded on the public document.
+*/
+func putReceiptPricing(ctx contractapi.TransactionContextInterface, pricing ReceiptPricing, mspIds ...string) (string, error) {
+	pricingJSON, err := json.Marshal(pricing)
+	if err != nil {
+		return "", fmt.Errorf("Failed to marshal pricing details: %v", err.Error())
+	}
+
+	written := make(map[string]bool)
+	for _, mspId := range mspIds {
+		if mspId == "" {
+			return "", fmt.Errorf("MSP ID is not registered for a party of the transaction")
+		}
+		if written[mspId] {
+			continue
+		}
+
+		err = ctx.GetStub().PutPrivateData(pricingCollectionName(mspId), pricing.Id, pricingJSON)
+		if err != nil {
+			return "", fmt.Errorf("Failed to insert pricing details to collection of %v: %v", mspId, err.Error())
+		}
+		written[mspId] = true
+	}
+
+	hash := sha256.Sum256(pricingJSON)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+/*
+getReceiptPricing reads the pricing of a document from the pricing collection of the caller's organization
+and checks it against the hash recorded on the public document.
+*/
+func getReceiptPricing(ctx contractapi.TransactionContextInterface, id string, pricingHash string) (ReceiptPricing, error) {
+	mspId, err := getCallerMspId(ctx)
+	if err != nil {
+		return ReceiptPricing{}, err
+	}
+
+	pricingBytes, err := ctx.GetStub().GetPrivateData(pricingCollectionName(mspId), id)
+	if err != nil {
+		return ReceiptPricing{}, fmt.Errorf("Failed to get pricing details for ID %v: %v", id, err.Error())
+	}
+	if pricingBytes == nil {
+		return ReceiptPricing{}, fmt.Errorf("Pricing details for ID %v are not available to %v", id, mspId)
+	}
+
+	hash := sha256.Sum256(pricingBytes)
+	if hex.EncodeToString(hash[:]) != pricingHash {
+		return ReceiptPricing{}, fmt.Errorf("Pricing details for ID %v do not match the recorded hash", id)
+	}
+
+	var pricing ReceiptPricing
+	err = json.Unmarshal(pricingBytes, &pricing)
+	if err != nil {
+		return ReceiptPricing{}, err
+	}
+	return pricing, nil
+}
+
+/*
+getBillAmount returns the bill amount of a receipt. Receipts written before pricing moved
+to private data still carry the amount publicly.
+*/
+func getBillAmount(ctx contractapi.TransactionContextInterface, receipt Receipt) (int16, error) {
+	if receipt.PricingHash == "" {
+		return receipt.BillAmount, nil
+	}
+
+	pricing, err := getReceiptPricing(ctx, receipt.Id, receipt.PricingHash)
+	if err != nil {
+		return 0, err
+	}
+	return pricing.BillAmount, nil
+}
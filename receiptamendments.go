@@ -0,0 +1,468 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type ReceiptAmendment struct {
+	Id              string `json:"id"`
+	ReceiptId       string `json:"receiptId"`
+	PreviousId      string `json:"previousId,omitempty"`
+	Type            string `json:"type"`
+	PricingHash     string `json:"pricingHash"`
+	Reason          string `json:"reason"`
+	Status          string `json:"status"`
+	ProposedBy      string `json:"proposedBy"`
+	ProposedDate    int64  `json:"proposedDate"`
+	CountersignedBy string `json:"countersignedBy,omitempty"`
+	DecisionDate    int64  `json:"decisionDate,omitempty"`
+	Remarks         string `json:"remarks,omitempty"`
+	NoteId          string `json:"noteId,omitempty"`
+	DocType         string `json:"docType"`
+}
+
+type ReceiptView struct {
+	Receipt
+	AmendmentChain []ReceiptAmendment        `json:"amendmentChain,omitempty"`
+	Notes          []Receipt                 `json:"notes,omitempty"`
+	Pricing        map[string]ReceiptPricing `json:"pricing,omitempty"`
+}
+
+/*
+ProposeReceiptAmendment proposes the cancellation or the correction of the bill amount of a receipt.
+It is exclusively called by the Supplier of the receipt, and takes effect only once the Customer countersigns it.
+The corrected bill amount of an amendment is passed through the transient map under the key "pricing".
+A receipt already corrected is amended again through its latest credit or debit note, to which the new amendment is linked.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param amendmentInputString: JSON string with the amendment details
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) ProposeReceiptAmendment(ctx contractapi.TransactionContextInterface, amendmentInputString string) error {
+	amendmentInput := struct {
+		ReceiptId    string `json:"receiptId" validate:"required"`
+		Type         string `json:"type" validate:"required,oneof=CANCELLATION AMENDMENT"`
+		Reason       string `json:"reason" validate:"required"`
+		ProposedDate int64  `json:"proposedDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(amendmentInputString), &amendmentInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for receipt amendment: %v", err.Error())
+	}
+	fmt.Println("Input String:", amendmentInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(amendmentInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	supplierDetails, _, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Retrieves the amended version of the receipt and the original receipt it belongs to */
+	previous, err := getReceipt(ctx, amendmentInput.ReceiptId)
+	if err != nil {
+		return err
+	}
+	receipt := previous
+	if previous.NoteType != "" {
+		receipt, err = getReceipt(ctx, previous.OriginalReceiptId)
+		if err != nil {
+			return err
+		}
+	}
+
+	/* Verifies that the receipt can still be amended by the logged-in entity */
+	if receipt.SupplierId != supplierDetails.Id {
+		return fmt.Errorf("Only the supplier of the receipt is allowed to propose an amendment")
+	}
+	if previous.Status == ReceiptStatuses.Superseded {
+		return fmt.Errorf("Receipt %v is already superseded by amendment %v, amend its latest note instead", previous.Id, previous.SupersededBy)
+	}
+	if receipt.PendingAmendmentId != "" {
+		return fmt.Errorf("Receipt %v already has a pending amendment %v", receipt.Id, receipt.PendingAmendmentId)
+	}
+
+	/* Retrieves the corrected bill amount passed through the transient map */
+	pricing, err := getTransientPricing(ctx, amendmentInput.Type == "AMENDMENT")
+	if err != nil {
+		return err
+	}
+	billAmount, err := getEffectiveBillAmount(ctx, previous)
+	if err != nil {
+		return err
+	}
+	if amendmentInput.Type == "CANCELLATION" {
+		pricing.BillAmount = 0
+	} else if pricing.BillAmount == billAmount {
+		return fmt.Errorf("Proposed bill amount is the same as the current bill amount")
+	}
+
+	/* Inserts the proposed bill amount into the private collections of both parties */
+	txID := ctx.GetStub().GetTxID()
+	pricing.Id = txID
+	pricingHash, err := putReceiptPricing(ctx, pricing, receiptMspIds(ctx, receipt)...)
+	if err != nil {
+		return err
+	}
+
+	amendment := ReceiptAmendment{
+		Id:           txID,
+		ReceiptId:    receipt.Id,
+		PreviousId:   previous.Id,
+		Type:         amendmentInput.Type,
+		PricingHash:  pricingHash,
+		Reason:       amendmentInput.Reason,
+		Status:       AmendmentStatuses.Proposed,
+		ProposedBy:   supplierDetails.Id,
+		ProposedDate: amendmentInput.ProposedDate,
+		DocType:      RECEIPT_AMENDMENT,
+	}
+
+	/* Inserts the amendment proposal into the ledger */
+	err = insertData(ctx, amendment, txID, "")
+	if err != nil {
+		return err
+	}
+
+	/* Locks the receipt against further proposals until the customer decides */
+	receipt.PendingAmendmentId = txID
+	err = insertData(ctx, receipt, receipt.Id, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Propose Receipt Amendment Function ******************")
+	return nil
+}
+
+/*
+CountersignReceiptAmendment approves or rejects an amendment proposed by the Supplier.
+It is exclusively called by the Customer named on the receipt. On approval the amended version of the receipt,
+the original receipt or its latest note, is marked superseded and a linked credit note or debit note is created
+for the difference.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param countersignInputString: JSON string with the decision on the amendment
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) CountersignReceiptAmendment(ctx contractapi.TransactionContextInterface, countersignInputString string) error {
+	countersignInput := struct {
+		AmendmentId  string `json:"amendmentId" validate:"required"`
+		Approve      bool   `json:"approve"`
+		Remarks      string `json:"remarks"`
+		DecisionDate int64  `json:"decisionDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(countersignInputString), &countersignInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for countersign: %v", err.Error())
+	}
+	fmt.Println("Input String:", countersignInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(countersignInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	customerDetails, _, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Retrieves the amendment proposal */
+	var amendment ReceiptAmendment
+	amendmentBytes, err := ctx.GetStub().GetState(countersignInput.AmendmentId)
+	if err != nil {
+		return fmt.Errorf("failed to get amendment for ID: %s, %v", countersignInput.AmendmentId, err)
+	}
+	if amendmentBytes == nil {
+		return fmt.Errorf("Amendment does not exist for ID: %s", countersignInput.AmendmentId)
+	}
+	err = json.Unmarshal(amendmentBytes, &amendment)
+	if err != nil {
+		return err
+	}
+	if amendment.DocType != RECEIPT_AMENDMENT {
+		return fmt.Errorf("ID %s does not belong to a receipt amendment", countersignInput.AmendmentId)
+	}
+	if amendment.Status != AmendmentStatuses.Proposed {
+		return fmt.Errorf("Amendment %v is already %v", amendment.Id, amendment.Status)
+	}
+
+	receipt, err := getReceipt(ctx, amendment.ReceiptId)
+	if err != nil {
+		return err
+	}
+
+	/* Verifies that the logged-in entity is the customer of the receipt */
+	if receipt.CustomerId != customerDetails.Id {
+		return fmt.Errorf("Only the customer of the receipt is allowed to countersign the amendment")
+	}
+
+	/* Retrieves the amended version, which is the original receipt for amendments proposed before notes could be amended */
+	previous := &receipt
+	if amendment.PreviousId != "" && amendment.PreviousId != receipt.Id {
+		previousNote, err := getReceipt(ctx, amendment.PreviousId)
+		if err != nil {
+			return err
+		}
+		previous = &previousNote
+	}
+
+	/* Reads the proposed and the current bill amounts from the private collection of the customer */
+	proposedPricing, err := getReceiptPricing(ctx, amendment.Id, amendment.PricingHash)
+	if err != nil {
+		return err
+	}
+	billAmount, err := getEffectiveBillAmount(ctx, *previous)
+	if err != nil {
+		return err
+	}
+
+	amendment.CountersignedBy = customerDetails.Id
+	amendment.DecisionDate = countersignInput.DecisionDate
+	amendment.Remarks = countersignInput.Remarks
+	receipt.PendingAmendmentId = ""
+
+	if countersignInput.Approve {
+		/* Creates the credit or debit note for the difference in bill amount */
+		txID := ctx.GetStub().GetTxID()
+		note := Receipt{
+			Id:                txID,
+			BundleId:          receipt.BundleId,
+			DocType:           vaccinechainhelper.RECEIPT,
+			SupplierId:        receipt.SupplierId,
+			CustomerId:        receipt.CustomerId,
+			ProductId:         receipt.ProductId,
+			TransactionDate:   countersignInput.DecisionDate,
+			SupplierMspId:     receipt.SupplierMspId,
+			CustomerMspId:     receipt.CustomerMspId,
+			Status:            ReceiptStatuses.Active,
+			OriginalReceiptId: receipt.Id,
+		}
+		notePricing := ReceiptPricing{
+			Id:      txID,
+			Salt:    proposedPricing.Salt,
+			DocType: RECEIPT_PRICING,
+		}
+		if proposedPricing.BillAmount < billAmount {
+			note.NoteType = CREDIT_NOTE
+			notePricing.BillAmount = billAmount - proposedPricing.BillAmount
+		} else {
+			note.NoteType = DEBIT_NOTE
+			notePricing.BillAmount = proposedPricing.BillAmount - billAmount
+		}
+
+		/* Inserts the note amount into the private collections of both parties */
+		note.PricingHash, err = putReceiptPricing(ctx, notePricing, receiptMspIds(ctx, receipt)...)
+		if err != nil {
+			return err
+		}
+
+		err = insertData(ctx, note, txID, "")
+		if err != nil {
+			return err
+		}
+
+		amendment.Status = AmendmentStatuses.Approved
+		amendment.NoteId = txID
+		previous.Status = ReceiptStatuses.Superseded
+		previous.SupersededBy = amendment.Id
+	} else {
+		amendment.Status = AmendmentStatuses.Rejected
+	}
+
+	/* Updates the amendment, the original receipt and the amended note into the ledger */
+	err = insertData(ctx, amendment, amendment.Id, "")
+	if err != nil {
+		return err
+	}
+	err = insertData(ctx, receipt, receipt.Id, "")
+	if err != nil {
+		return err
+	}
+	if previous.Id != receipt.Id {
+		err = insertData(ctx, *previous, previous.Id, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("********** End of Countersign Receipt Amendment Function ******************")
+	return nil
+}
+
+func getReceipt(ctx contractapi.TransactionContextInterface, receiptId string) (Receipt, error) {
+	var receipt Receipt
+	receiptBytes, err := ctx.GetStub().GetState(receiptId)
+	if err != nil {
+		return Receipt{}, fmt.Errorf("failed to get receipt for ID: %s, %v", receiptId, err)
+	}
+	if receiptBytes == nil {
+		return Receipt{}, fmt.Errorf("Receipt does not exist for ID: %s", receiptId)
+	}
+	err = json.Unmarshal(receiptBytes, &receipt)
+	if err != nil {
+		return Receipt{}, err
+	}
+	if receipt.DocType != vaccinechainhelper.RECEIPT {
+		return Receipt{}, fmt.Errorf("ID %s does not belong to a receipt", receiptId)
+	}
+	return receipt, nil
+}
+
+/*
+getEffectiveBillAmount returns the bill amount in force for a version of a receipt: the amount of the receipt itself,
+or for a credit or debit note the corrected amount of the amendment it was issued for.
+*/
+func getEffectiveBillAmount(ctx contractapi.TransactionContextInterface, receipt Receipt) (int16, error) {
+	if receipt.NoteType == "" {
+		return getBillAmount(ctx, receipt)
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"docType":"%s","noteId":"%s"}}`, RECEIPT_AMENDMENT, receipt.Id)
+	fmt.Println("queryString:", queryString)
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return 0, err
+	}
+	defer resultsIterator.Close()
+
+	if !resultsIterator.HasNext() {
+		return 0, fmt.Errorf("No amendment found for %v %v", receipt.NoteType, receipt.Id)
+	}
+	queryResult, err := resultsIterator.Next()
+	if err != nil {
+		return 0, err
+	}
+
+	var amendment ReceiptAmendment
+	err = json.Unmarshal(queryResult.Value, &amendment)
+	if err != nil {
+		return 0, err
+	}
+	pricing, err := getReceiptPricing(ctx, amendment.Id, amendment.PricingHash)
+	if err != nil {
+		return 0, err
+	}
+	return pricing.BillAmount, nil
+}
+
+/*
+receiptMspIds returns the organizations whose pricing collections hold the pricing of a receipt.
+Receipts written before pricing moved to private data only know the organization of the caller.
+*/
+func receiptMspIds(ctx contractapi.TransactionContextInterface, receipt Receipt) []string {
+	var mspIds []string
+	for _, mspId := range []string{receipt.SupplierMspId, receipt.CustomerMspId} {
+		if mspId != "" {
+			mspIds = append(mspIds, mspId)
+		}
+	}
+	if len(mspIds) == 0 {
+		if callerMspId, err := getCallerMspId(ctx); err == nil {
+			mspIds = append(mspIds, callerMspId)
+		}
+	}
+	return mspIds
+}
+
+/*
+getReceiptView returns the JSON-encoded receipt together with every amendment proposed against
+its original receipt and the credit or debit notes issued for them.
+If withPricing is set, the private pricing available to the caller's organization is merged in, keyed by document ID.
+*/
+func getReceiptView(ctx contractapi.TransactionContextInterface, receipt Receipt, withPricing bool) (string, error) {
+	originalReceiptId := receipt.Id
+	if receipt.OriginalReceiptId != "" {
+		originalReceiptId = receipt.OriginalReceiptId
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"docType":"%s","receiptId":"%s"}}`, RECEIPT_AMENDMENT, originalReceiptId)
+	fmt.Println("queryString:", queryString)
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return "", err
+	}
+	defer resultsIterator.Close()
+
+	receiptView := ReceiptView{Receipt: receipt}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return "", err
+		}
+
+		var amendment ReceiptAmendment
+		err = json.Unmarshal(queryResult.Value, &amendment)
+		if err != nil {
+			return "", err
+		}
+		receiptView.AmendmentChain = append(receiptView.AmendmentChain, amendment)
+
+		if amendment.NoteId != "" {
+			note, err := getReceipt(ctx, amendment.NoteId)
+			if err != nil {
+				return "", err
+			}
+			receiptView.Notes = append(receiptView.Notes, note)
+		}
+	}
+
+	sort.Slice(receiptView.AmendmentChain, func(i, j int) bool {
+		return receiptView.AmendmentChain[i].ProposedDate < receiptView.AmendmentChain[j].ProposedDate
+	})
+
+	/* Merges the private pricing of the receipt, the amendments and the notes */
+	if withPricing {
+		receiptView.Pricing = make(map[string]ReceiptPricing)
+		pricingHashes := map[string]string{receipt.Id: receipt.PricingHash}
+		for _, amendment := range receiptView.AmendmentChain {
+			pricingHashes[amendment.Id] = amendment.PricingHash
+		}
+		for _, note := range receiptView.Notes {
+			pricingHashes[note.Id] = note.PricingHash
+		}
+
+		for id, pricingHash := range pricingHashes {
+			if pricingHash == "" {
+				continue
+			}
+			pricing, err := getReceiptPricing(ctx, id, pricingHash)
+			if err != nil {
+				return "", err
+			}
+			receiptView.Pricing[id] = pricing
+		}
+	}
+
+	receiptViewJSON, err := json.Marshal(receiptView)
+	if err != nil {
+		return "", err
+	}
+
+	return string(receiptViewJSON), nil
+}
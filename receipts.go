@@ -0,0 +1,286 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type ReceiptPage struct {
+	Records             json.RawMessage `json:"records"`
+	FetchedRecordsCount int32           `json:"fetchedRecordsCount"`
+	Bookmark            string          `json:"bookmark"`
+}
+
+type StatementLine struct {
+	CounterpartyId string `json:"counterpartyId"`
+	TotalSales     int64  `json:"totalSales"`
+	TotalPurchases int64  `json:"totalPurchases"`
+	ReceiptCount   int    `json:"receiptCount"`
+}
+
+type Statement struct {
+	EntityId string          `json:"entityId"`
+	FromDate int64           `json:"fromDate"`
+	ToDate   int64           `json:"toDate"`
+	Lines    []StatementLine `json:"lines"`
+}
+
+/*
+GetReceipts lists the receipts where the logged-in entity is the supplier or the customer.
+The list can be filtered by transaction date range, counterparty and product, and is returned page by page.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param filterInputString: JSON string with the receipt filters and pagination details
+
+@returns string: Returns the JSON-encoded page of receipts along with the bookmark for the next page
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetReceipts(ctx contractapi.TransactionContextInterface, filterInputString string) (string, error) {
+	filterInput := struct {
+		Role           string `json:"role" validate:"omitempty,oneof=SUPPLIER CUSTOMER"`
+		FromDate       int64  `json:"fromDate"`
+		ToDate         int64  `json:"toDate"`
+		CounterpartyId string `json:"counterpartyId"`
+		ProductId      string `json:"productId"`
+		PageSize       int32  `json:"pageSize" validate:"required,gt=0,lte=200"`
+		Bookmark       string `json:"bookmark"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(filterInputString), &filterInput)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the input string for receipt filters: %v", err.Error())
+	}
+	fmt.Println("Input String:", filterInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(filterInput)
+	if err != nil {
+		return "", err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, _, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Builds the selector restricted to receipts involving the logged-in entity */
+	selector := receiptSelector(entityDetails.Id, filterInput.Role, filterInput.CounterpartyId, filterInput.FromDate, filterInput.ToDate)
+	if filterInput.ProductId != "" {
+		selector["productId"] = filterInput.ProductId
+	}
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return "", fmt.Errorf("Failed to build receipt query: %v", err.Error())
+	}
+	fmt.Println("queryString:", string(queryBytes))
+
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(string(queryBytes), filterInput.PageSize, filterInput.Bookmark)
+	if err != nil {
+		return "", err
+	}
+	defer resultsIterator.Close()
+
+	records, err := constructQueryResponseFromIterator(resultsIterator)
+	if err != nil {
+		return "", err
+	}
+
+	page := ReceiptPage{
+		Records:             json.RawMessage(records),
+		FetchedRecordsCount: metadata.FetchedRecordsCount,
+		Bookmark:            metadata.Bookmark,
+	}
+	pageJSON, err := json.Marshal(page)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pageJSON), nil
+}
+
+/*
+GenerateStatement totals the bill amounts of the logged-in entity per counterparty for a period.
+Sales are the receipts where the entity is the supplier, purchases those where it is the customer.
+Debit notes are added to and credit notes deducted from the totals.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param statementInputString: JSON string with the statement period
+
+@returns string: Returns the JSON-encoded statement
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GenerateStatement(ctx contractapi.TransactionContextInterface, statementInputString string) (string, error) {
+	statementInput := struct {
+		FromDate int64 `json:"fromDate" validate:"required"`
+		ToDate   int64 `json:"toDate" validate:"required,gtefield=FromDate"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(statementInputString), &statementInput)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the input string for statement: %v", err.Error())
+	}
+	fmt.Println("Input String:", statementInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(statementInput)
+	if err != nil {
+		return "", err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, _, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Totals the receipts per counterparty, first as supplier and then as customer */
+	lines := make(map[string]*StatementLine)
+	var counterparties []string
+	for _, role := range []string{"SUPPLIER", "CUSTOMER"} {
+		selector := receiptSelector(entityDetails.Id, role, "", statementInput.FromDate, statementInput.ToDate)
+		receipts, err := getReceiptsForSelector(ctx, selector)
+		if err != nil {
+			return "", err
+		}
+
+		for _, receipt := range receipts {
+			counterpartyId := receipt.CustomerId
+			if role == "CUSTOMER" {
+				counterpartyId = receipt.SupplierId
+			}
+
+			line, ok := lines[counterpartyId]
+			if !ok {
+				line = &StatementLine{CounterpartyId: counterpartyId}
+				lines[counterpartyId] = line
+				counterparties = append(counterparties, counterpartyId)
+			}
+
+			/* Reads the bill amount from the private pricing of the caller's organization */
+			billAmount, err := getBillAmount(ctx, receipt)
+			if err != nil {
+				return "", err
+			}
+
+			/* Credit notes reduce the amount owed on the original receipt */
+			amount := int64(billAmount)
+			if receipt.NoteType == CREDIT_NOTE {
+				amount = -amount
+			}
+
+			if role == "SUPPLIER" {
+				line.TotalSales += amount
+			} else {
+				line.TotalPurchases += amount
+			}
+			line.ReceiptCount++
+		}
+	}
+
+	statement := Statement{
+		EntityId: entityDetails.Id,
+		FromDate: statementInput.FromDate,
+		ToDate:   statementInput.ToDate,
+		Lines:    []StatementLine{},
+	}
+	for _, counterpartyId := range counterparties {
+		statement.Lines = append(statement.Lines, *lines[counterpartyId])
+	}
+
+	statementJSON, err := json.Marshal(statement)
+	if err != nil {
+		return "", err
+	}
+
+	return string(statementJSON), nil
+}
+
+/*
+receiptSelector builds a CouchDB selector for the receipts of an entity.
+An empty role matches receipts where the entity is either the supplier or the customer,
+and a zero date leaves that end of the transaction date range open.
+*/
+func receiptSelector(entityId string, role string, counterpartyId string, fromDate int64, toDate int64) map[string]interface{} {
+	selector := map[string]interface{}{
+		"docType": vaccinechainhelper.RECEIPT,
+	}
+
+	switch role {
+	case "SUPPLIER":
+		selector["supplierId"] = entityId
+		if counterpartyId != "" {
+			selector["customerId"] = counterpartyId
+		}
+	case "CUSTOMER":
+		selector["customerId"] = entityId
+		if counterpartyId != "" {
+			selector["supplierId"] = counterpartyId
+		}
+	default:
+		if counterpartyId != "" {
+			selector["$or"] = []map[string]string{
+				{"supplierId": entityId, "customerId": counterpartyId},
+				{"supplierId": counterpartyId, "customerId": entityId},
+			}
+		} else {
+			selector["$or"] = []map[string]string{
+				{"supplierId": entityId},
+				{"customerId": entityId},
+			}
+		}
+	}
+
+	dateRange := map[string]int64{}
+	if fromDate != 0 {
+		dateRange["$gte"] = fromDate
+	}
+	if toDate != 0 {
+		dateRange["$lte"] = toDate
+	}
+	if len(dateRange) > 0 {
+		selector["transactionDate"] = dateRange
+	}
+
+	return selector
+}
+
+func getReceiptsForSelector(ctx contractapi.TransactionContextInterface, selector map[string]interface{}) ([]Receipt, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to build receipt query: %v", err.Error())
+	}
+	fmt.Println("queryString:", string(queryBytes))
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var receipts []Receipt
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var receipt Receipt
+		err = json.Unmarshal(queryResult.Value, &receipt)
+		if err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, nil
+}
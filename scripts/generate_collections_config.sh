@@ -0,0 +1,48 @@
+#!/bin/sh
+#
+# SPDX-License-Identifier: Apache-2.0
+#
+# Generates META-INF/collections_config.json for the organizations of the network.
+# Every organization gets its own pricing and patient collection. The adverse event
+# collection is shared by the organizations listed in ADVERSE_EVENT_MSPS.
+#
+# Usage: ./scripts/generate_collections_config.sh [MSP ID...] > META-INF/collections_config.json
+#
+# The MSP IDs default to Org1MSP Org2MSP Org3MSP, and ADVERSE_EVENT_MSPS to "Org1MSP RegulatorMSP".
+
+set -e
+
+if [ "$#" -eq 0 ]; then
+    set -- Org1MSP Org2MSP Org3MSP
+fi
+ADVERSE_EVENT_MSPS=${ADVERSE_EVENT_MSPS:-"Org1MSP RegulatorMSP"}
+
+# collection <name> <policy> <memberOnlyWrite>
+collection() {
+    cat <<JSON
+    {
+        "name":"$1",
+        "policy":"$2",
+        "requiredPeerCount":0,
+        "maxPeerCount":3,
+        "blockToLive":0,
+        "memberOnlyRead":true,
+        "memberOnlyWrite":$3
+    },
+JSON
+}
+
+echo "["
+for mspId in "$@"; do
+    collection "${mspId}PricingCollection" "OR('${mspId}.member')" false
+done
+for mspId in "$@"; do
+    collection "${mspId}PatientCollection" "OR('${mspId}.member')" true
+done
+
+members=""
+for mspId in $ADVERSE_EVENT_MSPS; do
+    members="${members:+$members,}'${mspId}.member'"
+done
+collection adverseEventCollection "OR($members)" false | sed '$s/},/}/'
+echo "]"
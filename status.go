@@ -0,0 +1,369 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+StatusChangeInput is the input of every status change. Products and batches are identified together with
+their manufacturer, which defaults to the logged-in Manufacturer.
+*/
+type StatusChangeInput struct {
+	Id             string `json:"id" validate:"required"`
+	DocType        string `json:"docType" validate:"required,oneof=VACCINE_CHAIN_ADMIN MANUFACTURER DISTRIBUTER CHEMIST HOSPITAL CLINIC REGULATOR AUDITOR WASTE_HANDLER LOGISTICS ITEM BATCH"`
+	ManufacturerId string `json:"manufacturerId"`
+	Status         bool   `json:"status"`
+	Reason         string `json:"reason" validate:"required"`
+	EffectiveDate  int64  `json:"effectiveDate"`
+}
+
+/*
+StatusChange is the audit record of a status change. It is written once and never updated.
+*/
+type StatusChange struct {
+	Id             string `json:"id"`
+	TargetId       string `json:"targetId"`
+	TargetType     string `json:"targetType"`
+	ManufacturerId string `json:"manufacturerId,omitempty"`
+	Suspended      bool   `json:"suspended"`
+	Reason         string `json:"reason"`
+	EffectiveDate  int64  `json:"effectiveDate,omitempty"`
+	CallerId       string `json:"callerId"`
+	CallerRole     string `json:"callerRole"`
+	CallerIdentity string `json:"callerIdentity"`
+	CallerMspId    string `json:"callerMspId"`
+	Timestamp      int64  `json:"timestamp"`
+	DocType        string `json:"docType"`
+}
+
+/*
+ChangeStatus suspends or reinstates an admin, an entity, a product or a batch. Admins are changed by the super admin,
+entities by the Vaccine Chain Admin, products by the Vaccine Chain Admin or their Manufacturer, and batches by the
+Vaccine Chain Admin, the Regulator or their Manufacturer. A reason is required, an audit record is written for every
+change and the "Status Change Alert" event is emitted.
+
+Suspending an entity freezes its inventory at once, which is released on reinstatement. Its effective date is
+recorded for information only.
+A suspended product or batch can no longer be shipped.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param changeStatusInputString: JSON string with the document, its new status and the reason
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) ChangeStatus(ctx contractapi.TransactionContextInterface, changeStatusInputString string) error {
+	var changeStatusInput StatusChangeInput
+
+	/* Unmarshals the input JSON string into the StatusChangeInput struct */
+	err := json.Unmarshal([]byte(changeStatusInputString), &changeStatusInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal input string for change status: %v", err.Error())
+	}
+	fmt.Println("Input String :", changeStatusInput)
+
+	return changeStatus(ctx, changeStatusInput)
+}
+
+/*
+ChangeAdminStatus suspends or reinstates a Vaccine Chain Admin. It is kept for existing clients and
+goes through ChangeStatus.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param changeStatusInputString: JSON string containing Admin details
+
+@returns error: Returns an error if the transaction encounters issues
+*/
+func (s *SmartContract) ChangeAdminStatus(ctx contractapi.TransactionContextInterface, changeStatusInputString string) error {
+	var changeStatusInput StatusChangeInput
+
+	/* Unmarshals the input JSON string into the StatusChangeInput struct */
+	err := json.Unmarshal([]byte(changeStatusInputString), &changeStatusInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for status change: %v", err.Error())
+	}
+	fmt.Println("Input String:", changeStatusInput)
+
+	if changeStatusInput.DocType != vaccinechainhelper.VACCINE_CHAIN_ADMIN {
+		return fmt.Errorf("ChangeAdminStatus only applies to %v", vaccinechainhelper.VACCINE_CHAIN_ADMIN)
+	}
+	return changeStatus(ctx, changeStatusInput)
+}
+
+/*
+ChangeEntityStatus suspends or reinstates an entity. It is kept for existing clients and goes through ChangeStatus.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param changeStatusInputString: JSON string containing Entity details
+
+@returns error: Returns an error if the transaction encounters issues
+*/
+func (s *SmartContract) ChangeEntityStatus(ctx contractapi.TransactionContextInterface, changeStatusInputString string) error {
+	var changeStatusInput StatusChangeInput
+
+	/* Unmarshals the input JSON string into the StatusChangeInput struct */
+	err := json.Unmarshal([]byte(changeStatusInputString), &changeStatusInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal input string for change status: %v", err.Error())
+	}
+	fmt.Println("Input String :", changeStatusInput)
+
+	if !isSuspendableEntityType(changeStatusInput.DocType) {
+		return fmt.Errorf("ChangeEntityStatus does not apply to %v", changeStatusInput.DocType)
+	}
+	return changeStatus(ctx, changeStatusInput)
+}
+
+/*
+GetStatusChanges lists the status changes recorded for an admin, an entity, a product or a batch.
+It is called by the Vaccine Chain Admin, the Regulator or the Auditor.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param targetId: ID of the admin, entity, product or batch
+
+@returns string: Returns the JSON-encoded list of status changes
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetStatusChanges(ctx contractapi.TransactionContextInterface, targetId string) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	_, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is allowed to view status changes */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN && role != REGULATOR && role != AUDITOR {
+		return "", fmt.Errorf("Only the Vaccine Chain Admin, the Regulator and the Auditor are allowed to view status changes")
+	}
+
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": map[string]interface{}{
+		"docType":  STATUS_CHANGE,
+		"targetId": targetId,
+	}})
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("queryString:", string(queryBytes))
+
+	return getQueryResultForQueryString(ctx, string(queryBytes))
+}
+
+/* changeStatus checks the caller, applies the new status to the document and records the change */
+func changeStatus(ctx contractapi.TransactionContextInterface, changeStatusInput StatusChangeInput) error {
+
+	/* Validates input parameters */
+	err := validateInputParams(changeStatusInput)
+	if err != nil {
+		return err
+	}
+
+	/* Identifies the caller and checks whether it may change the status of the document */
+	callerId, callerRole, err := authorizeStatusChange(ctx, &changeStatusInput)
+	if err != nil {
+		return err
+	}
+
+	/* Applies the new status to the document */
+	switch changeStatusInput.DocType {
+	case vaccinechainhelper.ITEM:
+		err = changeProductStatus(ctx, changeStatusInput)
+	case BATCH:
+		err = changeBatchStatus(ctx, changeStatusInput)
+	default:
+		err = changeEntityStatus(ctx, changeStatusInput)
+	}
+	if err != nil {
+		return err
+	}
+
+	/* Records the change */
+	err = recordStatusChange(ctx, changeStatusInput, callerId, callerRole)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Change Status Function ******************")
+	return nil
+}
+
+/* recordStatusChange writes the audit record of a status change and emits the "Status Change Alert" event */
+func recordStatusChange(ctx contractapi.TransactionContextInterface, changeStatusInput StatusChangeInput, callerId string, callerRole string) error {
+	callerIdentity, err := vaccinechainhelper.GetUserIdentityName(ctx)
+	if err != nil {
+		return err
+	}
+	callerMspId, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("Failed to get MSP ID of the caller: %v", err.Error())
+	}
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	statusChange := StatusChange{
+		Id:             txID,
+		TargetId:       changeStatusInput.Id,
+		TargetType:     changeStatusInput.DocType,
+		ManufacturerId: changeStatusInput.ManufacturerId,
+		Suspended:      changeStatusInput.Status,
+		Reason:         changeStatusInput.Reason,
+		EffectiveDate:  changeStatusInput.EffectiveDate,
+		CallerId:       callerId,
+		CallerRole:     callerRole,
+		CallerIdentity: callerIdentity,
+		CallerMspId:    callerMspId,
+		Timestamp:      timestamp.Unix(),
+		DocType:        STATUS_CHANGE,
+	}
+	err = insertData(ctx, statusChange, txID, "")
+	if err != nil {
+		return err
+	}
+
+	statusChangeJSON, err := json.Marshal(statusChange)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().SetEvent("Status Change Alert", statusChangeJSON)
+	if err != nil {
+		return fmt.Errorf("failed to setEvent Status Change Alert: %v", err.Error())
+	}
+	return nil
+}
+
+/*
+authorizeStatusChange returns the ID and role of the caller if it may change the status of the document.
+The manufacturer of a product or batch defaults to the logged-in Manufacturer.
+*/
+func authorizeStatusChange(ctx contractapi.TransactionContextInterface, changeStatusInput *StatusChangeInput) (string, string, error) {
+
+	/* Only the super admin changes the status of an admin */
+	if changeStatusInput.DocType == vaccinechainhelper.VACCINE_CHAIN_ADMIN {
+		superAdmin, err := checkSuperAdmin(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		return superAdmin.Identity, SUPER_ADMIN_ROLE, nil
+	}
+
+	/* Validates logged-in entity whether it is active or not */
+	callerDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch changeStatusInput.DocType {
+	case vaccinechainhelper.ITEM, BATCH:
+		if role == vaccinechainhelper.MANUFACTURER {
+			if changeStatusInput.ManufacturerId == "" {
+				changeStatusInput.ManufacturerId = callerDetails.Id
+			}
+			if changeStatusInput.ManufacturerId != callerDetails.Id {
+				return "", "", fmt.Errorf("Permission denied: Manufacturers can only change the status of their own products and batches")
+			}
+		} else if !(role == vaccinechainhelper.VACCINE_CHAIN_ADMIN ||
+			(role == REGULATOR && changeStatusInput.DocType == BATCH)) {
+			return "", "", fmt.Errorf("Permission denied: you cannot change the status of %v", changeStatusInput.DocType)
+		}
+		if changeStatusInput.ManufacturerId == "" {
+			return "", "", fmt.Errorf("Manufacturer ID is required to change the status of %v", changeStatusInput.DocType)
+		}
+	default:
+		if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN {
+			return "", "", fmt.Errorf("Permission denied: only admin can change the status of %v", changeStatusInput.DocType)
+		}
+	}
+	return callerDetails.Id, role, nil
+}
+
+/* changeEntityStatus suspends or reinstates an admin or an entity, freezing or releasing the inventory of an entity */
+func changeEntityStatus(ctx contractapi.TransactionContextInterface, changeStatusInput StatusChangeInput) error {
+	objectBytes, err := vaccinechainhelper.IsExist(ctx, changeStatusInput.Id, changeStatusInput.DocType)
+	if err != nil {
+		return err
+	}
+	if objectBytes == nil {
+		return fmt.Errorf("Record for %v user does not exist", changeStatusInput.Id)
+	}
+
+	var entity Entity
+	err = json.Unmarshal(objectBytes, &entity)
+	if err != nil {
+		return fmt.Errorf("Failed to convert entity details: %v", err.Error())
+	}
+	if entity.Suspended == changeStatusInput.Status {
+		return fmt.Errorf("Status is already %v", entity.Suspended)
+	}
+
+	/* Records the suspension and freezes or releases the inventory of the entity */
+	if changeStatusInput.DocType != vaccinechainhelper.VACCINE_CHAIN_ADMIN {
+		err = applyEntitySuspension(ctx, &entity, changeStatusInput.Status, changeStatusInput.Reason, changeStatusInput.EffectiveDate)
+		if err != nil {
+			return err
+		}
+	}
+
+	/* Updates the new status to the ledger */
+	entity.Suspended = changeStatusInput.Status
+	return insertData(ctx, entity, changeStatusInput.Id, changeStatusInput.DocType)
+}
+
+/* changeProductStatus suspends or reinstates a product of a manufacturer */
+func changeProductStatus(ctx contractapi.TransactionContextInterface, changeStatusInput StatusChangeInput) error {
+	productKey := changeStatusInput.Id + changeStatusInput.ManufacturerId
+	productBytes, err := vaccinechainhelper.IsExist(ctx, productKey, vaccinechainhelper.ITEM)
+	if err != nil {
+		return err
+	}
+	if productBytes == nil {
+		return fmt.Errorf("Product %v does not exist for manufacturer %v", changeStatusInput.Id, changeStatusInput.ManufacturerId)
+	}
+
+	var product Product
+	err = json.Unmarshal(productBytes, &product)
+	if err != nil {
+		return fmt.Errorf("Failed to convert product details: %v", err.Error())
+	}
+	if product.Suspended == changeStatusInput.Status {
+		return fmt.Errorf("Status is already %v", product.Suspended)
+	}
+
+	/* Updates the new status to the ledger */
+	product.Suspended = changeStatusInput.Status
+	return insertData(ctx, product, productKey, vaccinechainhelper.ITEM)
+}
+
+/* changeBatchStatus suspends or reinstates a batch of a manufacturer */
+func changeBatchStatus(ctx contractapi.TransactionContextInterface, changeStatusInput StatusChangeInput) error {
+	batchDetails, err := getBatch(ctx, changeStatusInput.ManufacturerId, changeStatusInput.Id)
+	if err != nil {
+		return err
+	}
+	if batchDetails.Suspended == changeStatusInput.Status {
+		return fmt.Errorf("Status is already %v", batchDetails.Suspended)
+	}
+
+	/* Updates the new status to the ledger */
+	batchDetails.Suspended = changeStatusInput.Status
+	return insertData(ctx, batchDetails, changeStatusInput.ManufacturerId, changeStatusInput.Id)
+}
+
+/* isSuspendableEntityType reports whether the document type is that of an entity other than an admin */
+func isSuspendableEntityType(docType string) bool {
+	switch docType {
+	case vaccinechainhelper.MANUFACTURER, vaccinechainhelper.DISTRIBUTER, vaccinechainhelper.CHEMIST, HOSPITAL, CLINIC,
+		REGULATOR, AUDITOR, WASTE_HANDLER, LOGISTICS:
+		return true
+	}
+	return false
+}
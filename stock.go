@@ -0,0 +1,249 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type StockLine struct {
+	ProductId      string `json:"productId"`
+	ManufacturerId string `json:"manufacturerId"`
+	BatchId        string `json:"batchId"`
+	LotNumber      string `json:"lotNumber"`
+	Status         string `json:"status"`
+	ExpiryBucket   string `json:"expiryBucket"`
+	Packets        int    `json:"packets"`
+	Doses          int64  `json:"doses"`
+	LocationId     string `json:"locationId,omitempty"`
+}
+
+type StockReport struct {
+	EntityId string      `json:"entityId,omitempty"`
+	AsOf     int64       `json:"asOf"`
+	Lines    []StockLine `json:"lines"`
+}
+
+/* Asset statuses counted as stock on hand */
+var stockStatuses = []string{
+	vaccinechainhelper.Statuses.ReadyForDistribution,
+	vaccinechainhelper.Statuses.ReceivedAtDistributor,
+	vaccinechainhelper.Statuses.ChemistInventoryReceived,
+	AssetStatuses.VialOpened,
+	AssetStatuses.DisposalRequested,
+	AssetStatuses.Frozen,
+}
+
+/*
+GetStockOnHand reports the stock held by the logged-in entity, counted by product, batch, status and expiry bucket.
+
+@param ctx: TransactionContextInterface for the smart contract
+
+@returns string: Returns the JSON-encoded stock-on-hand report
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetStockOnHand(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, _, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return getStockReport(ctx, entityDetails.Id, false)
+}
+
+/*
+GetEntityStockOnHand reports the stock held by any entity. It is exclusively called by the Vaccine Chain Admin.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param entityId: ID of the entity
+
+@returns string: Returns the JSON-encoded stock-on-hand report
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetEntityStockOnHand(ctx contractapi.TransactionContextInterface, entityId string) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	_, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is that of a vaccine chain admin */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN {
+		return "", fmt.Errorf("Only the Vaccine Chain Admin is allowed to view the stock of another entity")
+	}
+
+	return getStockReport(ctx, entityId, false)
+}
+
+/*
+GetNetworkStockOnHand reports the stock held across the whole network. It is called by the Vaccine Chain Admin
+or the Regulator.
+
+@param ctx: TransactionContextInterface for the smart contract
+
+@returns string: Returns the JSON-encoded stock-on-hand report
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetNetworkStockOnHand(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	_, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is allowed to view the network stock */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN && role != REGULATOR {
+		return "", fmt.Errorf("Only the Vaccine Chain Admin and the Regulator are allowed to view the network stock")
+	}
+
+	return getStockReport(ctx, "", false)
+}
+
+/*
+getStockReport aggregates the assets in stock for an owner, or for the whole network if ownerId is empty.
+The assets are selected through the owner and status indexes and read page by page, so that the report is not
+truncated by the query limit. If byLocation is set, the lines are also split by the location the assets are kept at.
+*/
+func getStockReport(ctx contractapi.TransactionContextInterface, ownerId string, byLocation bool) (string, error) {
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	asOf := timestamp.Unix()
+
+	selector := map[string]interface{}{
+		"docType": vaccinechainhelper.ASSET,
+		"status":  map[string]interface{}{"$in": stockStatuses},
+	}
+	if ownerId != "" {
+		selector["owner"] = ownerId
+	}
+	queryBytes, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("queryString:", string(queryBytes))
+
+	lines := make(map[string]*StockLine)
+	err = forEachAsset(ctx, string(queryBytes), func(asset Asset) {
+		bucket := expiryBucket(asset.ExpiryDate, asOf)
+		lineKey := asset.ProductId + "|" + asset.ManufacturerId + "|" + asset.BatchId + "|" + asset.Status + "|" + bucket
+		locationId := ""
+		if byLocation {
+			locationId = asset.LocationId
+			lineKey = locationId + "|" + lineKey
+		}
+		line, ok := lines[lineKey]
+		if !ok {
+			line = &StockLine{
+				ProductId:      asset.ProductId,
+				ManufacturerId: asset.ManufacturerId,
+				BatchId:        asset.BatchId,
+				LotNumber:      asset.LotNumber,
+				Status:         asset.Status,
+				ExpiryBucket:   bucket,
+				LocationId:     locationId,
+			}
+			lines[lineKey] = line
+		}
+		line.Packets++
+		line.Doses += int64(asset.DosesRemaining)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	report := StockReport{
+		EntityId: ownerId,
+		AsOf:     asOf,
+		Lines:    []StockLine{},
+	}
+	lineKeys := make([]string, 0, len(lines))
+	for lineKey := range lines {
+		lineKeys = append(lineKeys, lineKey)
+	}
+	sort.Strings(lineKeys)
+	for _, lineKey := range lineKeys {
+		report.Lines = append(report.Lines, *lines[lineKey])
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return "", err
+	}
+
+	return string(reportJSON), nil
+}
+
+/*
+forEachAsset calls visit for every asset matching the query string, paging through the results so that none are
+dropped by the query limit. Pagination is only available to queries, not to update transactions.
+*/
+func forEachAsset(ctx contractapi.TransactionContextInterface, queryString string, visit func(Asset)) error {
+	bookmark := ""
+	for {
+		fetched, nextBookmark, err := forEachAssetInPage(ctx, queryString, bookmark, visit)
+		if err != nil {
+			return err
+		}
+		if fetched < QUERY_PAGE_SIZE || nextBookmark == "" {
+			return nil
+		}
+		bookmark = nextBookmark
+	}
+}
+
+/* forEachAssetInPage calls visit for every asset of one page of results and returns the bookmark of the next page */
+func forEachAssetInPage(ctx contractapi.TransactionContextInterface, queryString string, bookmark string, visit func(Asset)) (int32, string, error) {
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(queryString, QUERY_PAGE_SIZE, bookmark)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return 0, "", err
+		}
+
+		var asset Asset
+		err = json.Unmarshal(queryResult.Value, &asset)
+		if err != nil {
+			return 0, "", err
+		}
+		visit(asset)
+	}
+	return metadata.FetchedRecordsCount, metadata.Bookmark, nil
+}
+
+/*
+expiryBucket returns the expiry bucket of an asset, the days left being counted in whole days and each bucket
+including its upper bound. Dates are Unix timestamps in seconds.
+*/
+func expiryBucket(expiryDate int64, asOf int64) string {
+	daysLeft := (expiryDate - asOf) / 86400
+	switch {
+	case expiryDate <= asOf:
+		return ExpiryBuckets.Expired
+	case daysLeft <= 30:
+		return ExpiryBuckets.Within30
+	case daysLeft <= 90:
+		return ExpiryBuckets.Within90
+	case daysLeft <= 180:
+		return ExpiryBuckets.Within180
+	default:
+		return ExpiryBuckets.Beyond180
+	}
+}
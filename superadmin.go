@@ -0,0 +1,303 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type SuperAdmin struct {
+	MspId    string `json:"mspId" validate:"required"`
+	Identity string `json:"identity" validate:"required"`
+}
+
+/*
+SuperAdminConfig holds the super admins recorded on the ledger and the number of them required to rotate the set.
+*/
+type SuperAdminConfig struct {
+	Admins    []SuperAdmin `json:"admins"`
+	Threshold int          `json:"threshold"`
+	Version   int          `json:"version"`
+	DocType   string       `json:"docType"`
+}
+
+/*
+SuperAdminRotation is a proposal to replace the super admins. It is applied once approved by the number of
+current super admins set by the threshold.
+*/
+type SuperAdminRotation struct {
+	Id            string       `json:"id"`
+	Admins        []SuperAdmin `json:"admins"`
+	Threshold     int          `json:"threshold"`
+	ConfigVersion int          `json:"configVersion"`
+	Approvals     []SuperAdmin `json:"approvals"`
+	Applied       bool         `json:"applied"`
+	DocType       string       `json:"docType"`
+}
+
+/*
+InitLedger records the calling super admin, with its MSP ID and certificate identity, on the ledger. It can only be
+called once, by the super admin identity the chaincode was originally deployed with, from the organization set by
+SUPER_ADMIN_MSP_ID. It is meant to be invoked as the init transaction of the chaincode definition (--init-required),
+so that no other transaction can run before it. From then on the super admins are read from the ledger and rotated
+with ProposeSuperAdminRotation.
+
+@param ctx: TransactionContextInterface for the smart contract
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
+	config, err := getSuperAdminConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if config.Version != 0 {
+		return fmt.Errorf("Super admin has already been recorded on the ledger")
+	}
+
+	caller, err := getCallerAsSuperAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if !isDeployedSuperAdmin(caller) {
+		return fmt.Errorf("Permission denied: only the super admin of %v can initialise the ledger", SUPER_ADMIN_MSP_ID)
+	}
+
+	config = SuperAdminConfig{
+		Admins:    []SuperAdmin{caller},
+		Threshold: 1,
+		Version:   1,
+		DocType:   SUPER_ADMIN_CONFIG,
+	}
+	err = insertData(ctx, config, SUPER_ADMIN_CONFIG, CONFIG)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Init Ledger Function ******************")
+	return nil
+}
+
+/*
+ProposeSuperAdminRotation proposes a new set of super admins, along with the number of them required for the next
+rotation. It is called by a current super admin, whose approval is counted. The rotation is applied at once when
+a single approval is required, otherwise the other super admins approve it with ApproveSuperAdminRotation.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param rotationInputString: JSON string with the new super admins and threshold
+
+@returns string: Returns the ID of the rotation proposal
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) ProposeSuperAdminRotation(ctx contractapi.TransactionContextInterface, rotationInputString string) (string, error) {
+	rotationInput := struct {
+		Admins    []SuperAdmin `json:"admins" validate:"required,min=1,dive"`
+		Threshold int          `json:"threshold" validate:"required,gte=1"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(rotationInputString), &rotationInput)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the input string for super admin rotation: %v", err.Error())
+	}
+	fmt.Println("Input String:", rotationInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(rotationInput)
+	if err != nil {
+		return "", err
+	}
+	if rotationInput.Threshold > len(rotationInput.Admins) {
+		return "", fmt.Errorf("Threshold cannot exceed the number of super admins")
+	}
+	listed := make(map[SuperAdmin]bool)
+	for _, admin := range rotationInput.Admins {
+		if listed[admin] {
+			return "", fmt.Errorf("Super admin %v of %v is listed more than once", admin.Identity, admin.MspId)
+		}
+		listed[admin] = true
+	}
+
+	/* Validates the caller as a current super admin */
+	config, err := getSuperAdminConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	if config.Version == 0 {
+		return "", fmt.Errorf("Super admin has not been recorded on the ledger, call InitLedger first")
+	}
+	caller, err := checkSuperAdmin(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	rotation := SuperAdminRotation{
+		Id:            txID,
+		Admins:        rotationInput.Admins,
+		Threshold:     rotationInput.Threshold,
+		ConfigVersion: config.Version,
+		Approvals:     []SuperAdmin{caller},
+		DocType:       SUPER_ADMIN_ROTATION,
+	}
+
+	err = applySuperAdminRotation(ctx, &rotation, config)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("********** End of Propose Super Admin Rotation Function ******************")
+	return txID, nil
+}
+
+/*
+ApproveSuperAdminRotation approves a pending super admin rotation. It is called by a current super admin, and the
+rotation is applied once the approvals reach the threshold.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param rotationId: ID of the rotation proposal
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) ApproveSuperAdminRotation(ctx contractapi.TransactionContextInterface, rotationId string) error {
+
+	/* Validates the caller as a current super admin */
+	config, err := getSuperAdminConfig(ctx)
+	if err != nil {
+		return err
+	}
+	if config.Version == 0 {
+		return fmt.Errorf("Super admin has not been recorded on the ledger, call InitLedger first")
+	}
+	caller, err := checkSuperAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	rotationBytes, err := ctx.GetStub().GetState(rotationId)
+	if err != nil {
+		return fmt.Errorf("Failed to get super admin rotation %v: %v", rotationId, err.Error())
+	}
+	if rotationBytes == nil {
+		return fmt.Errorf("Record does not exist with ID: %v", rotationId)
+	}
+
+	var rotation SuperAdminRotation
+	err = json.Unmarshal(rotationBytes, &rotation)
+	if err != nil {
+		return err
+	}
+	if rotation.DocType != SUPER_ADMIN_ROTATION {
+		return fmt.Errorf("ID %v does not belong to a super admin rotation", rotationId)
+	}
+	if rotation.Applied {
+		return fmt.Errorf("Super admin rotation %v has already been applied", rotationId)
+	}
+	if rotation.ConfigVersion != config.Version {
+		return fmt.Errorf("Super admin rotation %v was proposed for super admins that have since been replaced", rotationId)
+	}
+	for _, approval := range rotation.Approvals {
+		if approval == caller {
+			return fmt.Errorf("Super admin rotation %v is already approved by %v", rotationId, caller.Identity)
+		}
+	}
+
+	rotation.Approvals = append(rotation.Approvals, caller)
+	err = applySuperAdminRotation(ctx, &rotation, config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Approve Super Admin Rotation Function ******************")
+	return nil
+}
+
+/*
+applySuperAdminRotation saves the rotation and, once its approvals reach the threshold of the current super admins,
+replaces them with the proposed ones.
+*/
+func applySuperAdminRotation(ctx contractapi.TransactionContextInterface, rotation *SuperAdminRotation, config SuperAdminConfig) error {
+	if len(rotation.Approvals) >= config.Threshold {
+		rotation.Applied = true
+		config.Admins = rotation.Admins
+		config.Threshold = rotation.Threshold
+		config.Version++
+		err := insertData(ctx, config, SUPER_ADMIN_CONFIG, CONFIG)
+		if err != nil {
+			return err
+		}
+	}
+	return insertData(ctx, *rotation, rotation.Id, "")
+}
+
+/*
+checkSuperAdmin checks that the caller is a super admin recorded on the ledger. Until InitLedger has been called,
+the identity the chaincode was originally deployed with is accepted from the organization set by SUPER_ADMIN_MSP_ID.
+*/
+func checkSuperAdmin(ctx contractapi.TransactionContextInterface) (SuperAdmin, error) {
+	caller, err := getCallerAsSuperAdmin(ctx)
+	if err != nil {
+		return SuperAdmin{}, err
+	}
+	fmt.Println("Super Admin Identity: ", caller.Identity)
+
+	config, err := getSuperAdminConfig(ctx)
+	if err != nil {
+		return SuperAdmin{}, err
+	}
+	if config.Version == 0 {
+		if !isDeployedSuperAdmin(caller) {
+			return SuperAdmin{}, fmt.Errorf("Permission denied: only the super admin can call this function")
+		}
+		return caller, nil
+	}
+
+	for _, admin := range config.Admins {
+		if admin == caller {
+			return caller, nil
+		}
+	}
+	return SuperAdmin{}, fmt.Errorf("Permission denied: only the super admin can call this function")
+}
+
+/* isDeployedSuperAdmin checks the caller against the super admin the chaincode was deployed with */
+func isDeployedSuperAdmin(caller SuperAdmin) bool {
+	return caller.Identity == vaccinechainhelper.SUPER_ADMIN && caller.MspId == SUPER_ADMIN_MSP_ID
+}
+
+/* getSuperAdminConfig returns the super admins recorded on the ledger, or an empty configuration before InitLedger */
+func getSuperAdminConfig(ctx contractapi.TransactionContextInterface) (SuperAdminConfig, error) {
+	configBytes, err := vaccinechainhelper.IsExist(ctx, SUPER_ADMIN_CONFIG, CONFIG)
+	if err != nil {
+		return SuperAdminConfig{}, err
+	}
+	if configBytes == nil {
+		return SuperAdminConfig{}, nil
+	}
+
+	var config SuperAdminConfig
+	err = json.Unmarshal(configBytes, &config)
+	if err != nil {
+		return SuperAdminConfig{}, fmt.Errorf("Failed to convert super admin configuration: %v", err.Error())
+	}
+	return config, nil
+}
+
+/* getCallerAsSuperAdmin returns the MSP ID and certificate identity of the caller */
+func getCallerAsSuperAdmin(ctx contractapi.TransactionContextInterface) (SuperAdmin, error) {
+	identity, err := vaccinechainhelper.GetUserIdentityName(ctx)
+	if err != nil {
+		return SuperAdmin{}, err
+	}
+	mspId, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return SuperAdmin{}, fmt.Errorf("Failed to get MSP ID of the caller: %v", err.Error())
+	}
+	return SuperAdmin{MspId: mspId, Identity: identity}, nil
+}
@@ -0,0 +1,432 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+StrandedTransfer records the transfer, by the admin, of inventory left with a suspended or deregistered entity.
+*/
+type StrandedTransfer struct {
+	Id            string   `json:"id"`
+	FromEntityId  string   `json:"fromEntityId"`
+	ToEntityId    string   `json:"toEntityId"`
+	AssetIds      []string `json:"assetIds"`
+	Reason        string   `json:"reason"`
+	TransferDate  int64    `json:"transferDate"`
+	TransferredBy string   `json:"transferredBy"`
+	DocType       string   `json:"docType"`
+}
+
+/* Asset statuses frozen by the suspension of their owner */
+var suspendableStatuses = []string{
+	vaccinechainhelper.Statuses.ReadyForDistribution,
+	vaccinechainhelper.Statuses.ReceivedAtDistributor,
+	vaccinechainhelper.Statuses.ChemistInventoryReceived,
+	AssetStatuses.VialOpened,
+}
+
+/*
+DeregisterEntity permanently removes an entity from the network. Its inventory is frozen at once until the admin
+transfers it to another licensed entity with TransferStrandedInventory, while the effective date is recorded for
+information only. It is exclusively called by the Vaccine Chain Admin.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param deregisterInputString: JSON string with the entity, the reason and the effective date
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) DeregisterEntity(ctx contractapi.TransactionContextInterface, deregisterInputString string) error {
+	deregisterInput := struct {
+		Id            string `json:"id" validate:"required"`
+		DocType       string `json:"docType" validate:"required,oneof=MANUFACTURER DISTRIBUTER CHEMIST HOSPITAL CLINIC REGULATOR AUDITOR WASTE_HANDLER LOGISTICS"`
+		Reason        string `json:"reason" validate:"required"`
+		EffectiveDate int64  `json:"effectiveDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(deregisterInputString), &deregisterInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for deregistration: %v", err.Error())
+	}
+	fmt.Println("Input String:", deregisterInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(deregisterInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	adminDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is that of a vaccine chain admin */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN {
+		return fmt.Errorf("Only the Vaccine Chain Admin is allowed to deregister entities")
+	}
+
+	entityBytes, err := vaccinechainhelper.IsExist(ctx, deregisterInput.Id, deregisterInput.DocType)
+	if err != nil {
+		return err
+	}
+	if entityBytes == nil {
+		return fmt.Errorf("Record does not exist with ID: %v", deregisterInput.Id)
+	}
+
+	var entity Entity
+	err = json.Unmarshal(entityBytes, &entity)
+	if err != nil {
+		return fmt.Errorf("Failed to convert entity details: %v", err.Error())
+	}
+	if entity.Deregistered {
+		return fmt.Errorf("%v %v has already been deregistered", deregisterInput.DocType, entity.Id)
+	}
+
+	/* An entity already suspended keeps its inventory frozen */
+	if !entity.Suspended {
+		err = freezeEntityInventory(ctx, entity.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	entity.Suspended = true
+	entity.Deregistered = true
+	entity.SuspensionReason = deregisterInput.Reason
+	entity.SuspensionDate = deregisterInput.EffectiveDate
+	err = insertData(ctx, entity, entity.Id, deregisterInput.DocType)
+	if err != nil {
+		return err
+	}
+
+	/* Records the deregistration along with the other status changes */
+	err = recordStatusChange(ctx, StatusChangeInput{
+		Id:            entity.Id,
+		DocType:       deregisterInput.DocType,
+		Status:        true,
+		Reason:        deregisterInput.Reason,
+		EffectiveDate: deregisterInput.EffectiveDate,
+	}, adminDetails.Id, role)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Deregister Entity Function ******************")
+	return nil
+}
+
+/*
+TransferStrandedInventory moves the inventory frozen with a suspended or deregistered entity to another active,
+licensed entity, either ahead of reinstatement or after deregistration. All stranded assets are moved unless a list
+is given. It is exclusively called by the Vaccine Chain Admin, and the "Stranded Inventory Transfer Alert" event
+is emitted.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param transferInputString: JSON string with the entities, the assets and the reason
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) TransferStrandedInventory(ctx contractapi.TransactionContextInterface, transferInputString string) error {
+	transferInput := struct {
+		EntityId     string   `json:"entityId" validate:"required"`
+		DocType      string   `json:"docType" validate:"required,oneof=MANUFACTURER DISTRIBUTER CHEMIST HOSPITAL CLINIC"`
+		RecipientId  string   `json:"recipientId" validate:"required,nefield=EntityId"`
+		AssetIds     []string `json:"assetIds" validate:"dive,required"`
+		Reason       string   `json:"reason" validate:"required"`
+		TransferDate int64    `json:"transferDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(transferInputString), &transferInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for stranded inventory transfer: %v", err.Error())
+	}
+	fmt.Println("Input String:", transferInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(transferInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	adminDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is that of a vaccine chain admin */
+	if role != vaccinechainhelper.VACCINE_CHAIN_ADMIN {
+		return fmt.Errorf("Only the Vaccine Chain Admin is allowed to transfer stranded inventory")
+	}
+
+	/* Checks that the holder of the inventory is suspended or deregistered */
+	entityBytes, err := vaccinechainhelper.IsExist(ctx, transferInput.EntityId, transferInput.DocType)
+	if err != nil {
+		return err
+	}
+	if entityBytes == nil {
+		return fmt.Errorf("Record does not exist with ID: %v", transferInput.EntityId)
+	}
+
+	var entity Entity
+	err = json.Unmarshal(entityBytes, &entity)
+	if err != nil {
+		return fmt.Errorf("Failed to convert entity details: %v", err.Error())
+	}
+	if !entity.Suspended {
+		return fmt.Errorf("%v %v is active and holds no stranded inventory", transferInput.DocType, entity.Id)
+	}
+
+	/* Checks if the recipient is active and licensed */
+	_, recipientType, err := getActiveEntity(ctx, transferInput.RecipientId, vaccinechainhelper.MANUFACTURER,
+		vaccinechainhelper.DISTRIBUTER, vaccinechainhelper.CHEMIST, HOSPITAL, CLINIC)
+	if err != nil {
+		return err
+	}
+
+	stranded, err := getSuspendedAssets(ctx, entity.Id)
+	if err != nil {
+		return err
+	}
+	strandedById := make(map[string]Asset)
+	for _, asset := range stranded {
+		strandedById[asset.Id] = asset
+	}
+
+	assetIds := transferInput.AssetIds
+	if len(assetIds) == 0 {
+		for _, asset := range stranded {
+			assetIds = append(assetIds, asset.Id)
+		}
+	}
+	if len(assetIds) == 0 {
+		return fmt.Errorf("No stranded inventory found for %v", entity.Id)
+	}
+
+	/* Hands every asset over to the recipient, in the status matching its tier */
+	for _, assetId := range assetIds {
+		asset, ok := strandedById[assetId]
+		if !ok {
+			return fmt.Errorf("Asset %v is not stranded with %v", assetId, entity.Id)
+		}
+		delete(strandedById, assetId)
+
+		status, err := strandedAssetStatus(asset, recipientType)
+		if err != nil {
+			return err
+		}
+		asset.Owner = transferInput.RecipientId
+		asset.Status = status
+		asset.PreviousStatus = ""
+		asset.SuspensionRef = ""
+		asset.LocationId = ""
+		err = insertData(ctx, asset, asset.Id, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	strandedTransfer := StrandedTransfer{
+		Id:            txID,
+		FromEntityId:  entity.Id,
+		ToEntityId:    transferInput.RecipientId,
+		AssetIds:      assetIds,
+		Reason:        transferInput.Reason,
+		TransferDate:  transferInput.TransferDate,
+		TransferredBy: adminDetails.Id,
+		DocType:       STRANDED_TRANSFER,
+	}
+
+	/* Inserts the transfer into the ledger */
+	err = insertData(ctx, strandedTransfer, txID, "")
+	if err != nil {
+		return err
+	}
+
+	transferJSON, err := json.Marshal(strandedTransfer)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().SetEvent("Stranded Inventory Transfer Alert", transferJSON)
+	if err != nil {
+		return fmt.Errorf("failed to setEvent Stranded Inventory Transfer Alert: %v", err.Error())
+	}
+
+	fmt.Println("********** End of Transfer Stranded Inventory Function ******************")
+	return nil
+}
+
+/*
+applyEntitySuspension records the reason and effective date of a suspension and freezes the inventory of the entity.
+The freeze applies at once, the effective date being informational only. On reinstatement the suspension details are
+cleared and the inventory still held is released.
+*/
+func applyEntitySuspension(ctx contractapi.TransactionContextInterface, entity *Entity, suspend bool, reason string, effectiveDate int64) error {
+	if entity.Deregistered {
+		return fmt.Errorf("%v %v has been deregistered", entity.DocType, entity.Id)
+	}
+
+	if !suspend {
+		entity.SuspensionReason = ""
+		entity.SuspensionDate = 0
+		return releaseEntityInventory(ctx, entity.Id)
+	}
+
+	if reason == "" || effectiveDate == 0 {
+		return fmt.Errorf("Reason and effective date are required to suspend %v", entity.Id)
+	}
+	entity.SuspensionReason = reason
+	entity.SuspensionDate = effectiveDate
+	return freezeEntityInventory(ctx, entity.Id)
+}
+
+/* freezeEntityInventory freezes the assets held by an entity, remembering their status for reinstatement */
+func freezeEntityInventory(ctx contractapi.TransactionContextInterface, entityId string) error {
+	assets, err := getAssetsByOwnerAndStatus(ctx, entityId, map[string]interface{}{"$in": suspendableStatuses})
+	if err != nil {
+		return err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	for _, asset := range assets {
+		asset.PreviousStatus = asset.Status
+		asset.Status = AssetStatuses.Frozen
+		asset.SuspensionRef = txID
+		err = insertData(ctx, asset, asset.Id, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* releaseEntityInventory restores the assets frozen by the suspension of an entity to their previous status */
+func releaseEntityInventory(ctx contractapi.TransactionContextInterface, entityId string) error {
+	assets, err := getSuspendedAssets(ctx, entityId)
+	if err != nil {
+		return err
+	}
+
+	for _, asset := range assets {
+		asset.Status = asset.PreviousStatus
+		asset.PreviousStatus = ""
+		asset.SuspensionRef = ""
+		err = insertData(ctx, asset, asset.Id, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/* getSuspendedAssets returns the assets of an entity frozen by its suspension */
+func getSuspendedAssets(ctx contractapi.TransactionContextInterface, entityId string) ([]Asset, error) {
+	assets, err := getAssetsByOwnerAndStatus(ctx, entityId, AssetStatuses.Frozen)
+	if err != nil {
+		return nil, err
+	}
+
+	suspended := []Asset{}
+	for _, asset := range assets {
+		if asset.SuspensionRef != "" {
+			suspended = append(suspended, asset)
+		}
+	}
+	return suspended, nil
+}
+
+/* isEntitySuspended checks whether the entity holding inventory under an ID is suspended or deregistered */
+func isEntitySuspended(ctx contractapi.TransactionContextInterface, entityId string) (bool, error) {
+	for _, docType := range []string{vaccinechainhelper.MANUFACTURER, vaccinechainhelper.DISTRIBUTER,
+		vaccinechainhelper.CHEMIST, HOSPITAL, CLINIC} {
+		entityBytes, err := vaccinechainhelper.IsExist(ctx, entityId, docType)
+		if err != nil {
+			return false, err
+		}
+		if entityBytes == nil {
+			continue
+		}
+
+		var entity Entity
+		err = json.Unmarshal(entityBytes, &entity)
+		if err != nil {
+			return false, fmt.Errorf("Failed to convert entity details: %v", err.Error())
+		}
+		return entity.Suspended, nil
+	}
+	return false, nil
+}
+
+/*
+getAssetsByOwnerAndStatus returns the assets of an owner in the given status. As it is used by update transactions,
+which cannot page through results, it fails rather than act on a result truncated by the query limit.
+*/
+func getAssetsByOwnerAndStatus(ctx contractapi.TransactionContextInterface, ownerId string, status interface{}) ([]Asset, error) {
+	queryBytes, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{
+			"docType": vaccinechainhelper.ASSET,
+			"owner":   ownerId,
+			"status":  status,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("queryString:", string(queryBytes))
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(string(queryBytes))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	assets := []Asset{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var asset Asset
+		err = json.Unmarshal(queryResult.Value, &asset)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	if len(assets) >= TOTAL_QUERY_LIMIT {
+		return nil, fmt.Errorf("Inventory of %v reaches the query limit of %v assets and cannot be processed in one transaction",
+			ownerId, TOTAL_QUERY_LIMIT)
+	}
+	return assets, nil
+}
+
+/* strandedAssetStatus returns the status a stranded asset takes with a recipient of the given type */
+func strandedAssetStatus(asset Asset, recipientType string) (string, error) {
+	switch {
+	case asset.PreviousStatus == AssetStatuses.VialOpened:
+		if !isDispensingRole(recipientType) {
+			return "", fmt.Errorf("Opened vial %v can only be transferred to a Chemist, Hospital or Clinic", asset.Id)
+		}
+		return AssetStatuses.VialOpened, nil
+	case recipientType == vaccinechainhelper.MANUFACTURER:
+		return vaccinechainhelper.Statuses.ReadyForDistribution, nil
+	case recipientType == vaccinechainhelper.DISTRIBUTER:
+		return vaccinechainhelper.Statuses.ReceivedAtDistributor, nil
+	default:
+		return vaccinechainhelper.Statuses.ChemistInventoryReceived, nil
+	}
+}
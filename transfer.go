@@ -0,0 +1,273 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+/*
+TransferToDistributor transfers a carton or a packet between two distributors, for networks with
+super-stockists, regional distributors and sub-distributors. It is exclusively called by the Distributor
+holding the stock. A receipt is created for the transfer and the "Distributor Transfer Alert" event is emitted.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param transferInputString: JSON string with the transfer details, naming either a carton or a packet.
+The per-unit selling price is passed through the transient map under the key "pricing".
+
+@returns string: Returns the JSON-encoded rejection when the packet was reported lost or stolen, otherwise empty
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) TransferToDistributor(ctx contractapi.TransactionContextInterface, transferInputString string) (string, error) {
+	transferInput := struct {
+		CustomerId            string `json:"customerId" validate:"required"`
+		CartonId              string `json:"cartonId" validate:"required_without=PacketId,excluded_with=PacketId"`
+		PacketId              string `json:"packetId" validate:"required_without=CartonId"`
+		TransactionDate       int64  `json:"transactionDate" validate:"required"`
+		FefoOverrideReason    string `json:"fefoOverrideReason"`
+		DestinationLocationId string `json:"destinationLocationId"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(transferInputString), &transferInput)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the input string for distributor transfer: %v", err.Error())
+	}
+	fmt.Println("Input String:", transferInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(transferInput)
+	if err != nil {
+		return "", err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	distributerDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is that of a distributor */
+	if role != vaccinechainhelper.DISTRIBUTER {
+		return "", fmt.Errorf("Only Distributors are allowed to transfer stock to another distributor")
+	}
+
+	/* Selects the carton or the packet held by the distributor */
+	bundleId := transferInput.CartonId
+	queryString := fmt.Sprintf(`{"selector":{"owner":"%s","cartonId":"%s","status":"%s"}}`,
+		distributerDetails.Id, transferInput.CartonId, vaccinechainhelper.Statuses.ReceivedAtDistributor)
+	if transferInput.PacketId != "" {
+		/* Raises an alert instead of transferring a packet reported lost or stolen */
+		rejection, err := raiseIncidentAlert(ctx, transferInput.PacketId, distributerDetails.Id, "TransferToDistributor")
+		if err != nil {
+			return "", err
+		}
+		if rejection != "" {
+			return rejection, nil
+		}
+
+		bundleId = transferInput.PacketId
+		queryString = fmt.Sprintf(`{"selector":{"owner":"%s","id":"%s","status":"%s"}}`,
+			distributerDetails.Id, transferInput.PacketId, vaccinechainhelper.Statuses.ReceivedAtDistributor)
+	}
+
+	return "", transferStock(ctx, distributerDetails, vaccinechainhelper.DISTRIBUTER, transferInput.CustomerId, bundleId, queryString,
+		vaccinechainhelper.Statuses.ReceivedAtDistributor, transferInput.DestinationLocationId, transferInput.TransactionDate,
+		transferInput.FefoOverrideReason, "Distributor Transfer Alert")
+}
+
+/*
+TransferToChemist transfers a packet between two chemists to balance their stock. It is exclusively called by
+the Chemist holding the packet. Opened multi-dose vials cannot be transferred. A receipt is created for the transfer
+and the "Chemist Transfer Alert" event is emitted.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param transferInputString: JSON string with the transfer details.
+The per-unit selling price is passed through the transient map under the key "pricing".
+
+@returns string: Returns the JSON-encoded rejection when the packet was reported lost or stolen, otherwise empty
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) TransferToChemist(ctx contractapi.TransactionContextInterface, transferInputString string) (string, error) {
+	transferInput := struct {
+		CustomerId            string `json:"customerId" validate:"required"`
+		PacketId              string `json:"packetId" validate:"required"`
+		TransactionDate       int64  `json:"transactionDate" validate:"required"`
+		FefoOverrideReason    string `json:"fefoOverrideReason"`
+		DestinationLocationId string `json:"destinationLocationId"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(transferInputString), &transferInput)
+	if err != nil {
+		return "", fmt.Errorf("Failed to unmarshal the input string for chemist transfer: %v", err.Error())
+	}
+	fmt.Println("Input String:", transferInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(transferInput)
+	if err != nil {
+		return "", err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	chemistDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is that of a chemist */
+	if role != vaccinechainhelper.CHEMIST {
+		return "", fmt.Errorf("Only Chemists are allowed to transfer stock to another chemist")
+	}
+
+	/* Raises an alert instead of transferring a packet reported lost or stolen */
+	rejection, err := raiseIncidentAlert(ctx, transferInput.PacketId, chemistDetails.Id, "TransferToChemist")
+	if err != nil {
+		return "", err
+	}
+	if rejection != "" {
+		return rejection, nil
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"owner":"%s","id":"%s","status":"%s"}}`,
+		chemistDetails.Id, transferInput.PacketId, vaccinechainhelper.Statuses.ChemistInventoryReceived)
+
+	return "", transferStock(ctx, chemistDetails, vaccinechainhelper.CHEMIST, transferInput.CustomerId, transferInput.PacketId, queryString,
+		vaccinechainhelper.Statuses.ChemistInventoryReceived, transferInput.DestinationLocationId, transferInput.TransactionDate,
+		transferInput.FefoOverrideReason, "Chemist Transfer Alert")
+}
+
+/*
+transferStock moves the assets matching the query string from the sender to another entity of the same tier,
+keeping their status, then creates the receipt and emits the transfer event.
+*/
+func transferStock(ctx contractapi.TransactionContextInterface, sender Entity, recipientType string, recipientId string,
+	bundleId string, queryString string, status string, destLocationId string, transactionDate int64, fefoOverrideReason string, eventName string) error {
+	if recipientId == sender.Id {
+		return fmt.Errorf("Stock cannot be transferred to the same entity")
+	}
+
+	/* Checks if the recipient exists and is active */
+	recipientBytes, err := vaccinechainhelper.IsActive(ctx, recipientId, recipientType)
+	if err != nil {
+		return err
+	}
+	if recipientBytes == nil {
+		return fmt.Errorf("Record does not exist with ID: %v", recipientId)
+	}
+
+	var recipientDetails Entity
+	err = json.Unmarshal(recipientBytes, &recipientDetails)
+	if err != nil {
+		return fmt.Errorf("Failed to convert recipient details: %v", err.Error())
+	}
+	err = checkLicenseValid(ctx, recipientDetails)
+	if err != nil {
+		return err
+	}
+
+	/* Checks that the destination location, if given, belongs to the recipient */
+	err = checkDestinationLocation(ctx, destLocationId, recipientId)
+	if err != nil {
+		return err
+	}
+
+	/* Retrieves the selling price passed through the transient map */
+	pricing, err := getTransientPricing(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	/* Updates Owner from the sender to the recipient */
+	fmt.Println("queryString:", queryString)
+	shippedAsset, totalBundle, err := getQueryResultForAssetUpdateQueryString(ctx, queryString, recipientId, status, destLocationId)
+	if err != nil {
+		return err
+	}
+
+	/* Checks that the batch has not been put on hold or rejected since its release */
+	err = checkBatchNotHeld(ctx, shippedAsset.ManufacturerId, shippedAsset.BatchId)
+	if err != nil {
+		return err
+	}
+
+	/* Enforces first-expiry-first-out dispatch when the policy of the sender requires it */
+	err = checkFefo(ctx, sender, shippedAsset, fefoOverrideReason)
+	if err != nil {
+		return err
+	}
+
+	/* Draws the transferred packets from the allocation of the recipient */
+	err = consumeAllocation(ctx, recipientId, shippedAsset.ProductId, shippedAsset.ManufacturerId, totalBundle)
+	if err != nil {
+		return err
+	}
+
+	/* Checks that the product has not been suspended */
+	productDetails, err := getActiveProduct(ctx, shippedAsset.ProductId, shippedAsset.ManufacturerId)
+	if err != nil {
+		return err
+	}
+
+	/* Checks that the pricing can be shared with the organization of the recipient */
+	err = checkEntityMspId(recipientDetails)
+	if err != nil {
+		return err
+	}
+
+	/* Creates a Receipt for the transfer, with the pricing kept private to both parties */
+	pricing.BillAmount = pricing.PerUnitSellingPrice * productDetails.PacketCapacity * totalBundle
+	err = createReceipt(
+		ctx,
+		bundleId,
+		sender.Id,
+		recipientId,
+		shippedAsset.ProductId,
+		transactionDate,
+		pricing,
+		recipientDetails.MspId,
+		shippedAsset.LocationId,
+		destLocationId)
+	if err != nil {
+		return err
+	}
+
+	/* Emits an event for the transfer */
+	event := struct {
+		SupplierId       string
+		CustomerId       string
+		TransactionDate  int64
+		ManufacturerId   string
+		ProductId        string
+		LotNumber        string
+		TotalParcelUnits int16
+	}{
+		SupplierId:       sender.Id,
+		CustomerId:       recipientId,
+		TransactionDate:  transactionDate,
+		ManufacturerId:   shippedAsset.ManufacturerId,
+		ProductId:        shippedAsset.ProductId,
+		LotNumber:        shippedAsset.LotNumber,
+		TotalParcelUnits: totalBundle,
+	}
+
+	eventDataJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent(eventName, eventDataJSON)
+	if err != nil {
+		return fmt.Errorf("failed to setEvent %v: %v", eventName, err.Error())
+	}
+
+	fmt.Println("********** End of Transfer Stock Function ******************")
+	return nil
+}
@@ -0,0 +1,199 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type VaccinationRecord struct {
+	Id               string `json:"id"`
+	PatientRef       string `json:"patientRef"`
+	PacketId         string `json:"packetId"`
+	ProductId        string `json:"productId"`
+	ManufacturerId   string `json:"manufacturerId"`
+	BatchId          string `json:"batchId"`
+	LotNumber        string `json:"lotNumber"`
+	DoseNumber       int16  `json:"doseNumber"`
+	Site             string `json:"site"`
+	AdministeredDate int64  `json:"administeredDate"`
+	VaccinatorId     string `json:"vaccinatorId"`
+	AdministeredBy   string `json:"administeredBy"`
+	DocType          string `json:"docType"`
+}
+
+/*
+AdministerDose records that a packet, or one dose of a multi-dose vial, was administered to a patient.
+It is called by the Chemist, Hospital or Clinic. The packet must either be held by the chemist or have been sold to the same patient.
+The patient identifier and its salt are passed through the transient map under the key "patient",
+and only the salted hash of it is recorded on the public ledger.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param administrationInputString: JSON string with the dose administration details
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) AdministerDose(ctx contractapi.TransactionContextInterface, administrationInputString string) error {
+	administrationInput := struct {
+		PacketId         string `json:"packetId" validate:"required"`
+		DoseNumber       int16  `json:"doseNumber" validate:"required,gt=0"`
+		Site             string `json:"site" validate:"required"`
+		AdministeredDate int64  `json:"administeredDate" validate:"required"`
+		VaccinatorId     string `json:"vaccinatorId" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(administrationInputString), &administrationInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for dose administration: %v", err.Error())
+	}
+	fmt.Println("Input String:", administrationInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(administrationInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	chemistDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is that of a chemist, hospital or clinic */
+	if !isDispensingRole(role) {
+		return fmt.Errorf("Only Chemists, Hospitals and Clinics are allowed to administer doses")
+	}
+
+	/* Replaces the patient identifier with its salted hash, keeping the clear value in the patient collection */
+	patientRef, err := putTransientPatient(ctx, chemistDetails.Id)
+	if err != nil {
+		return err
+	}
+
+	/* Verifies that the packet can be administered to the patient */
+	asset, err := getAsset(ctx, administrationInput.PacketId)
+	if err != nil {
+		return err
+	}
+
+	/* Checks that the batch has not been put on hold or rejected since its release */
+	err = checkBatchNotHeld(ctx, asset.ManufacturerId, asset.BatchId)
+	if err != nil {
+		return err
+	}
+	multiDoseVial := asset.DosesPerVial > 1 && asset.Owner == chemistDetails.Id
+	heldByChemist := asset.Owner == chemistDetails.Id && asset.Status == vaccinechainhelper.Statuses.ChemistInventoryReceived
+	soldToPatient := asset.Owner == patientRef && asset.Status == vaccinechainhelper.Statuses.SoldToCustomer
+	if !multiDoseVial && !heldByChemist && !soldToPatient {
+		return fmt.Errorf("Packet %v is neither held by %v nor sold to the patient", asset.Id, chemistDetails.Id)
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	vaccinationRecord := VaccinationRecord{
+		Id:               txID,
+		PatientRef:       patientRef,
+		PacketId:         asset.Id,
+		ProductId:        asset.ProductId,
+		ManufacturerId:   asset.ManufacturerId,
+		BatchId:          asset.BatchId,
+		LotNumber:        asset.LotNumber,
+		DoseNumber:       administrationInput.DoseNumber,
+		Site:             administrationInput.Site,
+		AdministeredDate: administrationInput.AdministeredDate,
+		VaccinatorId:     administrationInput.VaccinatorId,
+		AdministeredBy:   chemistDetails.Id,
+		DocType:          VACCINATION_RECORD,
+	}
+
+	/* Inserts the vaccination record into the ledger */
+	err = insertData(ctx, vaccinationRecord, txID, "")
+	if err != nil {
+		return err
+	}
+
+	/* Takes one dose from a multi-dose vial, or moves a single-dose packet to the administered state */
+	if multiDoseVial {
+		err = consumeVialDoses(ctx, &asset, 1)
+		if err != nil {
+			return err
+		}
+	} else {
+		asset.Owner = patientRef
+		asset.Status = AssetStatuses.Administered
+	}
+	err = insertData(ctx, asset, asset.Id, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Administer Dose Function ******************")
+	return nil
+}
+
+/*
+GetDoseHistory retrieves every dose administered to a patient, ordered by administration date,
+so that completion of the vaccination schedule can be verified. It is called by the Chemist, Hospital, Clinic or the Regulator.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param patientRef: Salted hash recorded for the patient on the public ledger
+
+@returns string: Returns the JSON-encoded list of vaccination records of the patient
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetDoseHistory(ctx contractapi.TransactionContextInterface, patientRef string) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	_, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user role is allowed to view dose histories */
+	if !isDispensingRole(role) && role != REGULATOR {
+		return "", fmt.Errorf("Only Chemists, Hospitals, Clinics and Regulators are allowed to view dose history")
+	}
+
+	queryString := fmt.Sprintf(`{"selector":{"docType":"%s","patientRef":"%s"}}`, VACCINATION_RECORD, patientRef)
+	fmt.Println("queryString:", queryString)
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return "", err
+	}
+	defer resultsIterator.Close()
+
+	doseHistory := []VaccinationRecord{}
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return "", err
+		}
+
+		var vaccinationRecord VaccinationRecord
+		err = json.Unmarshal(queryResult.Value, &vaccinationRecord)
+		if err != nil {
+			return "", err
+		}
+		doseHistory = append(doseHistory, vaccinationRecord)
+	}
+
+	sort.Slice(doseHistory, func(i, j int) bool {
+		return doseHistory[i].AdministeredDate < doseHistory[j].AdministeredDate
+	})
+
+	doseHistoryJSON, err := json.Marshal(doseHistory)
+	if err != nil {
+		return "", err
+	}
+
+	return string(doseHistoryJSON), nil
+}
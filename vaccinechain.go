@@ -25,18 +25,25 @@ type SmartContract struct {
 }
 
 type Entity struct {
-	Id            string `json:"id" validate:"required"`
-	Name          string `json:"name,omitempty" validate:"validName"`
-	LicenseNo     string `json:"licenseNo,omitempty" validate:"required"`
-	Address       string `json:"address,omitempty"`                          //updatable
-	OwnerName     string `json:"ownerName,omitempty"`                        //updatable
-	OwnerIdentity string `json:"ownerIdentity,omitempty"`                    //updatable
-	OwnerAddress  string `json:"ownerAddress,omitempty"`                     //updatable
-	ContactNo     string `json:"contactNo,omitempty" validate:"validNumber"` //updatable
-	EmailId       string `json:"emailId,omitempty" validate:"email"`         //updatable
-	Suspended     bool   `json:"suspended"`
-	BatchCount    int    `json:"batchCount,omitempty"`
-	DocType       string `json:"docType" validate:"required,oneof=VACCINE_CHAIN_ADMIN MANUFACTURER DISTRIBUTER CHEMIST"`
+	Id                string `json:"id" validate:"required"`
+	Name              string `json:"name,omitempty" validate:"validName"`
+	LicenseNo         string `json:"licenseNo,omitempty" validate:"required"`
+	LicenseAuthority  string `json:"licenseAuthority,omitempty"`
+	LicenseIssueDate  int64  `json:"licenseIssueDate,omitempty"`
+	LicenseExpiryDate int64  `json:"licenseExpiryDate,omitempty" validate:"omitempty,gtfield=LicenseIssueDate"`
+	Address           string `json:"address,omitempty"`                          //updatable
+	OwnerName         string `json:"ownerName,omitempty"`                        //updatable
+	OwnerIdentity     string `json:"ownerIdentity,omitempty"`                    //updatable
+	OwnerAddress      string `json:"ownerAddress,omitempty"`                     //updatable
+	ContactNo         string `json:"contactNo,omitempty" validate:"validNumber"` //updatable
+	EmailId           string `json:"emailId,omitempty" validate:"email"`         //updatable
+	MspId             string `json:"mspId,omitempty" validate:"required"`
+	FefoEnabled       bool   `json:"fefoEnabled,omitempty"` //dispatch must follow first-expiry-first-out
+	Suspended         bool   `json:"suspended"`
+	SuspensionReason  string `json:"suspensionReason,omitempty"`
+	SuspensionDate    int64  `json:"suspensionDate,omitempty"`
+	Deregistered      bool   `json:"deregistered,omitempty"`
+	DocType           string `json:"docType" validate:"required,oneof=VACCINE_CHAIN_ADMIN MANUFACTURER DISTRIBUTER CHEMIST HOSPITAL CLINIC REGULATOR AUDITOR WASTE_HANDLER LOGISTICS"`
 }
 
 type Product struct {
@@ -47,6 +54,7 @@ type Product struct {
 	Price          int16  `json:"price"`
 	CartonCapacity int16  `json:"cartonCapacity"`
 	PacketCapacity int16  `json:"packetCapacity"`
+	DiscardHours   int16  `json:"discardHours" validate:"gte=0"` //hours an opened multi-dose vial may be used for
 	DocType        string `json:"docType" validate:"required,eq=ITEM"`
 	Suspended      bool   `json:"suspended"`
 	Owner          string `json:"owner"`
@@ -56,14 +64,32 @@ type Batch struct {
 	Id                string `json:"id,omitempty"`
 	Owner             string `json:"owner"`
 	ProductId         string `json:"productId"`
+	LotNumber         string `json:"lotNumber" validate:"required,validLotNumber"`
+	ManufacturingSite string `json:"manufacturingSite" validate:"required"`
+	Formulation       string `json:"formulation" validate:"required"`
+	DosesPerVial      int16  `json:"dosesPerVial" validate:"required,gt=0"`
+	StorageConditions string `json:"storageConditions" validate:"required"`
+	CoaReference      string `json:"coaReference" validate:"required"`
 	ManufacturingDate int64  `json:"manufacturingDate" validate:"required"`
 	ExpiryDate        int64  `json:"expiryDate" validate:"required,expiryGreaterThanManufacturing"`
 	CartonQnty        int16  `json:"cartonQnty"`
+	ReleaseStatus     string `json:"releaseStatus"`
+	PreHoldStatus     string `json:"preHoldStatus,omitempty"`
+	Suspended         bool   `json:"suspended"`
+}
+
+type Lot struct {
+	LotNumber string `json:"lotNumber"`
+	ProductId string `json:"productId"`
+	BatchId   string `json:"batchId"`
+	Owner     string `json:"owner"`
+	DocType   string `json:"docType"`
 }
 
 type Asset struct {
 	Id                string `json:"id"`
 	BatchId           string `json:"batchId"`
+	LotNumber         string `json:"lotNumber"`
 	CartonId          string `json:"cartonId"`
 	Owner             string `json:"owner"`
 	Status            string `json:"status"`
@@ -71,22 +97,44 @@ type Asset struct {
 	ManufacturerId    string `json:"manufacturerId"`
 	ManufacturingDate int64  `json:"manufacturingDate"`
 	ExpiryDate        int64  `json:"expiryDate"`
+	DosesPerVial      int16  `json:"dosesPerVial,omitempty"`
+	DosesRemaining    int16  `json:"dosesRemaining,omitempty"`
+	DosesWasted       int16  `json:"dosesWasted,omitempty"`
+	OpenedDate        int64  `json:"openedDate,omitempty"`
+	DiscardDate       int64  `json:"discardDate,omitempty"`   //end of the discard window of an opened vial
+	DiscardedDate     int64  `json:"discardedDate,omitempty"` //date the opened vial was actually discarded
+	LocationId        string `json:"locationId,omitempty"`
+	DisposalRef       string `json:"disposalRef,omitempty"`
+	IncidentId        string `json:"incidentId,omitempty"`
+	SuspensionRef     string `json:"suspensionRef,omitempty"`  //set while frozen by the suspension of its owner
+	PreviousStatus    string `json:"previousStatus,omitempty"` //status to restore once a frozen asset is released
 	DocType           string `json:"docType"`
 }
 
 type Receipt struct {
-	Id              string `json:"id"`
-	BundleId        string `json:"bundleId"`
-	DocType         string `json:"docType"`
-	SupplierId      string `json:"supplierId"`
-	CustomerId      string `json:"customerId"`
-	ProductId       string `json:"productId"`
-	TransactionDate int64  `json:"transactionDate"`
-	BillAmount      int16  `json:"billAmount"`
+	Id                 string `json:"id"`
+	BundleId           string `json:"bundleId"`
+	DocType            string `json:"docType"`
+	SupplierId         string `json:"supplierId"`
+	CustomerId         string `json:"customerId"`
+	ProductId          string `json:"productId"`
+	TransactionDate    int64  `json:"transactionDate"`
+	BillAmount         int16  `json:"billAmount,omitempty"` //only set on receipts written before pricing moved to private data
+	PricingHash        string `json:"pricingHash,omitempty"`
+	SupplierMspId      string `json:"supplierMspId,omitempty"`
+	CustomerMspId      string `json:"customerMspId,omitempty"`
+	Status             string `json:"status,omitempty"`
+	NoteType           string `json:"noteType,omitempty"`
+	OriginalReceiptId  string `json:"originalReceiptId,omitempty"`
+	PendingAmendmentId string `json:"pendingAmendmentId,omitempty"`
+	SupersededBy       string `json:"supersededBy,omitempty"`
+	OriginLocationId   string `json:"originLocationId,omitempty"`
+	DestLocationId     string `json:"destLocationId,omitempty"`
 }
 
 type History struct {
 	Id        string    `json:"id"`
+	LotNumber string    `json:"lotNumber"`
 	Owner     string    `json:"owner"`
 	Status    string    `json:"status"`
 	TxId      string    `json:"txId"`
@@ -94,6 +142,11 @@ type History struct {
 	IsDelete  bool      `json:"isDelete"`
 }
 
+type PacketTrack struct {
+	Ownership []History       `json:"ownership"`
+	Custody   []CustodyRecord `json:"custody"`
+}
+
 /*
 VaccineChainAdmin function adds a new admin to the vaccine chain system.
 It takes in a JSON string containing admin details and performs several validations
@@ -122,10 +175,9 @@ func (s *SmartContract) VaccineChainAdmin(ctx contractapi.TransactionContextInte
 	}
 
 	/* Validates the identity of the caller as the super admin */
-	superAdminIdentity, err := vaccinechainhelper.GetUserIdentityName(ctx)
-	fmt.Println("Super Admin Identity: ", superAdminIdentity)
-	if superAdminIdentity != vaccinechainhelper.SUPER_ADMIN {
-		return fmt.Errorf("Permission denied: only the super admin can call this function")
+	_, err = checkSuperAdmin(ctx)
+	if err != nil {
+		return err
 	}
 
 	/* Checks if admin is already present or not */
@@ -149,7 +201,7 @@ func (s *SmartContract) VaccineChainAdmin(ctx contractapi.TransactionContextInte
 }
 
 /*
-AddEntity function adds a new entity (Manufacturer, Distributor, Chemist) to the vaccine chain system.
+AddEntity function adds a new entity (Manufacturer, Distributor, Chemist, Regulator, Auditor) to the vaccine chain system.
 It takes in a JSON string containing entity details and performs several validations
 before inserting the entity record into the ledger.
 
@@ -270,6 +322,7 @@ func (s *SmartContract) AddProduct(ctx contractapi.TransactionContextInterface,
 AddBatch function incorporates a new Product Batch into the ledger, exclusively called by the Manufacturer.
 This function takes a JSON string containing Product Batch details, performs various validations,
 and subsequently inserts the batch record into the ledger. Additionally, it generates assets associated with the batch.
+The manufacturer-supplied lot number must be unique for the product and is carried on every asset of the batch.
 
 @param ctx: TransactionContextInterface for the smart contract
 @param batchInputString: JSON string with Batch details
@@ -316,14 +369,48 @@ func (s *SmartContract) AddBatch(ctx contractapi.TransactionContextInterface, ba
 	err = json.Unmarshal(objectBytes, &productDetails)
 	fmt.Println("Product Details:", productDetails)
 
-	/* Generating a unique Batch No */
-	batchInput.Id = "B" + strconv.Itoa(manufacturerDetails.BatchCount)
+	/* Generating a unique Batch No from the transaction ID, so concurrent batches never collide */
+	batchInput.Id = "B" + ctx.GetStub().GetTxID()
+	batchInput.Owner = manufacturerDetails.Id
+	batchInput.ReleaseStatus = ReleaseStatuses.PendingRelease
+	batchInput.PreHoldStatus = ""
 	fmt.Println("Batch ID:", batchInput.Id)
 
+	/* Checks that the lot number is unique for the product */
+	lotBytes, err := vaccinechainhelper.IsExist(ctx, batchInput.LotNumber, productId)
+	if err != nil {
+		return err
+	}
+	if lotBytes != nil {
+		return fmt.Errorf("Lot number %v already exists for product %v", batchInput.LotNumber, batchInput.ProductId)
+	}
+
+	/* Checks that the Batch No has not been used before */
+	objectBytes, err = vaccinechainhelper.IsExist(ctx, manufacturerDetails.Id, batchInput.Id)
+	if err != nil {
+		return err
+	}
+	if objectBytes != nil {
+		return fmt.Errorf("Record already exists for batch with ID: %v", batchInput.Id)
+	}
+
 	/* Inserts Batch Details into the ledger */
 	err = insertData(ctx, batchInput, manufacturerDetails.Id, batchInput.Id)
 	if err != nil {
-		return nil
+		return err
+	}
+
+	/* Reserves the lot number against the product */
+	lot := Lot{
+		LotNumber: batchInput.LotNumber,
+		ProductId: batchInput.ProductId,
+		BatchId:   batchInput.Id,
+		Owner:     manufacturerDetails.Id,
+		DocType:   LOT,
+	}
+	err = insertData(ctx, lot, batchInput.LotNumber, productId)
+	if err != nil {
+		return err
 	}
 
 	/* Insert Asset Records for each item in the batch */
@@ -342,6 +429,7 @@ func (s *SmartContract) AddBatch(ctx contractapi.TransactionContextInterface, ba
 			asset := Asset{
 				Id:                assetId,
 				BatchId:           batchInput.Id,
+				LotNumber:         batchInput.LotNumber,
 				CartonId:          cartonId,
 				Owner:             manufacturerDetails.Id,
 				Status:            vaccinechainhelper.Statuses.ReadyForDistribution,
@@ -349,6 +437,8 @@ func (s *SmartContract) AddBatch(ctx contractapi.TransactionContextInterface, ba
 				ManufacturerId:    manufacturerDetails.Id,
 				ManufacturingDate: batchInput.ManufacturingDate,
 				ExpiryDate:        batchInput.ExpiryDate,
+				DosesPerVial:      batchInput.DosesPerVial,
+				DosesRemaining:    batchInput.DosesPerVial,
 				DocType:           vaccinechainhelper.ASSET,
 			}
 
@@ -365,16 +455,7 @@ func (s *SmartContract) AddBatch(ctx contractapi.TransactionContextInterface, ba
 		}
 	}
 
-	/* Update batch count attribute for the manufacturer */
-	newBatchNo := manufacturerDetails.BatchCount + 1
-	manufacturerDetails.BatchCount = newBatchNo
-
-	/* Updating manufacturer Details into the ledger */
-	err = insertData(ctx, manufacturerDetails, manufacturerDetails.Id, manufacturerDetails.DocType)
-	if err != nil {
-		return nil
-	}
-
+	fmt.Println("********** End of Add Batch Function ******************")
 	return nil
 }
 
@@ -382,21 +463,25 @@ func (s *SmartContract) AddBatch(ctx contractapi.TransactionContextInterface, ba
 ShipToDistributor function is exclusively called by the Manufacturer.
 This function takes a JSON string containing Shipment details and performs the following operations:
 
-1. Transfers the Assets corresponding to BatchId that belong to the manufacturer, to the Distributor.
+1. Transfers the Assets corresponding to BatchId that belong to the manufacturer, to the Distributor, once the batch is released.
+Hospitals and clinics can also receive directly from the manufacturer for government programmes.
+Shipments beyond the allocation set for the customer are refused.
 2. Creates a receipt for the shipment details.
 3. Emits an event for the transaction.
 
 @param ctx: TransactionContextInterface for the smart contract.
 @param distributionInputString: JSON string with Distributor Shipment details.
+The per-unit selling price is passed through the transient map under the key "pricing".
 
 @returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
 */
 func (s *SmartContract) ShipToDistributor(ctx contractapi.TransactionContextInterface, distributionInputString string) error {
 	distributionInput := struct {
-		CustomerId          string `json:"customerId"`
-		CartonId            string `json:"cartonId"`
-		TransactionDate     int64  `json:"transactionDate"`
-		PerUnitSellingPrice int16  `json:"perUnitSellingPrice"`
+		CustomerId            string `json:"customerId"`
+		CartonId              string `json:"cartonId"`
+		TransactionDate       int64  `json:"transactionDate"`
+		FefoOverrideReason    string `json:"fefoOverrideReason"`
+		DestinationLocationId string `json:"destinationLocationId"`
 	}{}
 
 	/* Unmarshals the input JSON string into the unnamed struct */
@@ -407,29 +492,67 @@ func (s *SmartContract) ShipToDistributor(ctx contractapi.TransactionContextInte
 	fmt.Println("Input String:", distributionInput)
 
 	/* Validates the logged-in entity to ensure it is active */
-	manufacturerDetails, _, err := getProfileDetails(ctx)
+	manufacturerDetails, role, err := getProfileDetails(ctx)
 	if err != nil {
 		return err
 	}
 
-	/* Checks if the vendor exists */
-	vendorBytes, err := vaccinechainhelper.IsActive(ctx, distributionInput.CustomerId, vaccinechainhelper.DISTRIBUTER)
+	/* Checks if the user role is that of a manufacturer */
+	if role != vaccinechainhelper.MANUFACTURER {
+		return fmt.Errorf("Only Manufacturers are allowed to ship to distributors")
+	}
+
+	/* Checks if the vendor exists; hospitals and clinics receive directly for government programmes */
+	vendorDetails, vendorType, err := getActiveEntity(ctx, distributionInput.CustomerId, vaccinechainhelper.DISTRIBUTER, HOSPITAL, CLINIC)
 	if err != nil {
 		return err
 	}
-	if vendorBytes == nil {
-		return fmt.Errorf("Record does not exist with ID: %v", distributionInput.CustomerId)
+	receivedStatus, eventName := vaccinechainhelper.Statuses.ReceivedAtDistributor, "Distributor Shipment Alert"
+	if vendorType != vaccinechainhelper.DISTRIBUTER {
+		receivedStatus, eventName = vaccinechainhelper.Statuses.ChemistInventoryReceived, "Institution Shipment Alert"
+	}
+
+	/* Retrieves the selling price passed through the transient map */
+	pricing, err := getTransientPricing(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	/* Checks that the destination location, if given, belongs to the vendor */
+	err = checkDestinationLocation(ctx, distributionInput.DestinationLocationId, distributionInput.CustomerId)
+	if err != nil {
+		return err
 	}
 
 	/* Updating Owner from Manufacturer to distributor for all assets corresponding to batchid */
 	queryString := fmt.Sprintf(`{"selector":{"owner":"%s","cartonId":"%s"}}`, manufacturerDetails.Id, distributionInput.CartonId)
 	fmt.Println("queryString:", queryString)
 
-	productId, manufacturerId, totalBundle, err := getQueryResultForAssetUpdateQueryString(
+	shippedAsset, totalBundle, err := getQueryResultForAssetUpdateQueryString(
 		ctx,
 		queryString,
 		distributionInput.CustomerId,
-		vaccinechainhelper.Statuses.ReceivedAtDistributor)
+		receivedStatus,
+		distributionInput.DestinationLocationId)
+	if err != nil {
+		return err
+	}
+	productId, manufacturerId := shippedAsset.ProductId, shippedAsset.ManufacturerId
+
+	/* Refuses the shipment unless the regulator has released the batch; the error discards the owner updates above */
+	err = checkBatchReleased(ctx, manufacturerId, shippedAsset.BatchId)
+	if err != nil {
+		return err
+	}
+
+	/* Enforces first-expiry-first-out dispatch when the policy of the manufacturer requires it */
+	err = checkFefo(ctx, manufacturerDetails, shippedAsset, distributionInput.FefoOverrideReason)
+	if err != nil {
+		return err
+	}
+
+	/* Draws the shipped packets from the allocation of the vendor, refusing the shipment beyond it */
+	err = consumeAllocation(ctx, distributionInput.CustomerId, productId, manufacturerId, totalBundle)
 	if err != nil {
 		return err
 	}
@@ -452,8 +575,14 @@ func (s *SmartContract) ShipToDistributor(ctx contractapi.TransactionContextInte
 	err = json.Unmarshal(productBytes, &productDetails)
 	fmt.Println("productDetails:", productDetails)
 
-	/* Creating Receipt for the shipment transaction */
-	billAmount := distributionInput.PerUnitSellingPrice * productDetails.PacketCapacity * totalBundle
+	/* Checks that the pricing can be shared with the organization of the vendor */
+	err = checkEntityMspId(vendorDetails)
+	if err != nil {
+		return err
+	}
+
+	/* Creating Receipt for the shipment transaction, with the pricing kept private to both parties */
+	pricing.BillAmount = pricing.PerUnitSellingPrice * productDetails.PacketCapacity * totalBundle
 	err = createReceipt(
 		ctx,
 		distributionInput.CartonId,
@@ -461,30 +590,31 @@ func (s *SmartContract) ShipToDistributor(ctx contractapi.TransactionContextInte
 		distributionInput.CustomerId,
 		productId,
 		distributionInput.TransactionDate,
-		billAmount)
+		pricing,
+		vendorDetails.MspId,
+		shippedAsset.LocationId,
+		distributionInput.DestinationLocationId)
 	if err != nil {
 		return err
 	}
 
 	/* Emitting an event for the shipment transaction */
 	event := struct {
-		SupplierId          string
-		CustomerId          string
-		TransactionDate     int64
-		PerUnitSellingPrice int16
-		ManufacturerId      string
-		ProductId           string
-		TotalParcelUnits    int16
-		TotalBill           int16
+		SupplierId       string
+		CustomerId       string
+		TransactionDate  int64
+		ManufacturerId   string
+		ProductId        string
+		LotNumber        string
+		TotalParcelUnits int16
 	}{
-		SupplierId:          manufacturerDetails.Id,
-		CustomerId:          distributionInput.CustomerId,
-		TransactionDate:     distributionInput.TransactionDate,
-		PerUnitSellingPrice: distributionInput.PerUnitSellingPrice,
-		ManufacturerId:      manufacturerId,
-		ProductId:           productId,
-		TotalParcelUnits:    totalBundle,
-		TotalBill:           billAmount,
+		SupplierId:       manufacturerDetails.Id,
+		CustomerId:       distributionInput.CustomerId,
+		TransactionDate:  distributionInput.TransactionDate,
+		ManufacturerId:   manufacturerId,
+		ProductId:        productId,
+		LotNumber:        shippedAsset.LotNumber,
+		TotalParcelUnits: totalBundle,
 	}
 
 	eventDataJSON, err := json.Marshal(event)
@@ -492,7 +622,7 @@ func (s *SmartContract) ShipToDistributor(ctx contractapi.TransactionContextInte
 		return err
 	}
 
-	eventErr := ctx.GetStub().SetEvent("Distributor Shipment Alert", eventDataJSON)
+	eventErr := ctx.GetStub().SetEvent(eventName, eventDataJSON)
 	if eventErr != nil {
 		return fmt.Errorf("failed to setEvent Shipment Alert: %v", err.Error())
 	}
@@ -504,70 +634,123 @@ func (s *SmartContract) ShipToDistributor(ctx contractapi.TransactionContextInte
 The ShipToChemist function is specifically invoked by the Distributor.
 It processes a JSON string holding Shipment details and executes the following actions:
 
-1. Transfers Assets from the Distributor to the Chemist.
+1. Transfers Assets from the Distributor to the Chemist, Hospital or Clinic.
+Shipments beyond the allocation set for the customer are refused.
 2. Generates a receipt for the shipment specifics.
 3. Emits an event to mark the transaction.
 
+A packet reported lost or stolen is not shipped; the attempt is recorded instead and the
+"Incident Alert" event is emitted, so that the alert is committed with the transaction, and the rejection
+naming the incident is returned.
+
 @param ctx: TransactionContextInterface for the smart contract.
 @param distributionInputString: JSON string containing Chemist Shipment details.
+The per-unit selling price is passed through the transient map under the key "pricing".
 
+@returns string: Returns the JSON-encoded rejection when the packet was reported lost or stolen, otherwise empty
 @returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
 */
-func (s *SmartContract) ShipToChemist(ctx contractapi.TransactionContextInterface, distributionInputString string) error {
+func (s *SmartContract) ShipToChemist(ctx contractapi.TransactionContextInterface, distributionInputString string) (string, error) {
 	distributionInput := struct {
-		CustomerId          string `json:"customerId"`
-		PacketId            string `json:"packetId"`
-		TransactionDate     int64  `json:"transactionDate"`
-		PerUnitSellingPrice int16  `json:"perUnitSellingPrice"`
+		CustomerId            string `json:"customerId"`
+		PacketId              string `json:"packetId"`
+		TransactionDate       int64  `json:"transactionDate"`
+		FefoOverrideReason    string `json:"fefoOverrideReason"`
+		DestinationLocationId string `json:"destinationLocationId"`
 	}{}
 
 	/* Unmarshals the input JSON string into the unnamed struct */
 	err := json.Unmarshal([]byte(distributionInputString), &distributionInput)
 	if err != nil {
-		return fmt.Errorf("Failed to unmarshal input string for distribution: %v", err.Error())
+		return "", fmt.Errorf("Failed to unmarshal input string for distribution: %v", err.Error())
 	}
 	fmt.Println("Input String :", distributionInput)
 
 	/* Validates the logged-in entity to ensure it is active */
 	distributerDetails, _, err := getProfileDetails(ctx)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	/* Checks if the vendor exists */
-	vendorBytes, err := vaccinechainhelper.IsActive(ctx, distributionInput.CustomerId, vaccinechainhelper.CHEMIST)
+	/* Raises an alert instead of shipping a packet reported lost or stolen */
+	rejection, err := raiseIncidentAlert(ctx, distributionInput.PacketId, distributerDetails.Id, "ShipToChemist")
 	if err != nil {
-		return err
+		return "", err
+	}
+	if rejection != "" {
+		return rejection, nil
+	}
+
+	/* Checks if the vendor exists; hospitals and clinics receive like chemists */
+	vendorDetails, vendorType, err := getActiveEntity(ctx, distributionInput.CustomerId, vaccinechainhelper.CHEMIST, HOSPITAL, CLINIC)
+	if err != nil {
+		return "", err
+	}
+	eventName := "Chemist Shipment Alert"
+	if vendorType != vaccinechainhelper.CHEMIST {
+		eventName = "Institution Shipment Alert"
 	}
-	if vendorBytes == nil {
-		return fmt.Errorf("Record does not exist with ID: %v", distributionInput.CustomerId)
+
+	/* Retrieves the selling price passed through the transient map */
+	pricing, err := getTransientPricing(ctx, true)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks that the destination location, if given, belongs to the vendor */
+	err = checkDestinationLocation(ctx, distributionInput.DestinationLocationId, distributionInput.CustomerId)
+	if err != nil {
+		return "", err
 	}
 
-	/* Updates Owner from Distributor to Chemist for an asset */
-	queryString := fmt.Sprintf(`{"selector":{"owner":"%s","id":"%s"}}`, distributerDetails.Id, distributionInput.PacketId)
+	/* Updates Owner from Distributor to Chemist for an asset held in the distributor inventory */
+	queryString := fmt.Sprintf(`{"selector":{"owner":"%s","id":"%s","status":"%s"}}`,
+		distributerDetails.Id, distributionInput.PacketId, vaccinechainhelper.Statuses.ReceivedAtDistributor)
 	fmt.Println("queryString : ", queryString)
 
-	productId, manufacturerId, _, err := getQueryResultForAssetUpdateQueryString(ctx,
+	shippedAsset, totalBundle, err := getQueryResultForAssetUpdateQueryString(ctx,
 		queryString,
 		distributionInput.CustomerId,
-		vaccinechainhelper.Statuses.ChemistInventoryReceived)
+		vaccinechainhelper.Statuses.ChemistInventoryReceived,
+		distributionInput.DestinationLocationId)
 	if err != nil {
-		return err
+		return "", err
 	}
+	productId, manufacturerId := shippedAsset.ProductId, shippedAsset.ManufacturerId
 
-	/* Checks if the product, created by the manufacturer, exists */
-	var productDetails Product
-	tempProductId := productId + manufacturerId
-	productBytes, err := vaccinechainhelper.IsActive(ctx, tempProductId, vaccinechainhelper.ITEM)
+	/* Checks that the batch has not been put on hold or rejected since its release */
+	err = checkBatchNotHeld(ctx, manufacturerId, shippedAsset.BatchId)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	err = json.Unmarshal(productBytes, &productDetails)
+	/* Enforces first-expiry-first-out dispatch when the policy of the distributor requires it */
+	err = checkFefo(ctx, distributerDetails, shippedAsset, distributionInput.FefoOverrideReason)
+	if err != nil {
+		return "", err
+	}
+
+	/* Draws the shipped packets from the allocation of the vendor, refusing the shipment beyond it */
+	err = consumeAllocation(ctx, distributionInput.CustomerId, productId, manufacturerId, totalBundle)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the product, created by the manufacturer, exists and is active */
+	productDetails, err := getActiveProduct(ctx, productId, manufacturerId)
+	if err != nil {
+		return "", err
+	}
 	fmt.Println("productDetails :", productDetails)
 
-	/* Creates a Receipt for the shipment transaction */
-	billAmount := distributionInput.PerUnitSellingPrice * productDetails.PacketCapacity
+	/* Checks that the pricing can be shared with the organization of the vendor */
+	err = checkEntityMspId(vendorDetails)
+	if err != nil {
+		return "", err
+	}
+
+	/* Creates a Receipt for the shipment transaction, with the pricing kept private to both parties */
+	pricing.BillAmount = pricing.PerUnitSellingPrice * productDetails.PacketCapacity
 	err = createReceipt(
 		ctx,
 		distributionInput.PacketId,
@@ -575,43 +758,44 @@ func (s *SmartContract) ShipToChemist(ctx contractapi.TransactionContextInterfac
 		distributionInput.CustomerId,
 		productId,
 		distributionInput.TransactionDate,
-		billAmount)
+		pricing,
+		vendorDetails.MspId,
+		shippedAsset.LocationId,
+		distributionInput.DestinationLocationId)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	/* Emits an event for the shipment transaction */
 	event := struct {
-		SupplierId          string
-		CustomerId          string
-		TransactionDate     int64
-		PerUnitSellingPrice int16
-		ManufacturerId      string
-		ProductId           string
-		TotalParcelUnits    int16
-		TotalBill           int16
+		SupplierId       string
+		CustomerId       string
+		TransactionDate  int64
+		ManufacturerId   string
+		ProductId        string
+		LotNumber        string
+		TotalParcelUnits int16
 	}{
-		SupplierId:          distributerDetails.Id,
-		CustomerId:          distributionInput.CustomerId,
-		TransactionDate:     distributionInput.TransactionDate,
-		PerUnitSellingPrice: distributionInput.PerUnitSellingPrice,
-		ManufacturerId:      manufacturerId,
-		ProductId:           productId,
-		TotalParcelUnits:    1,
-		TotalBill:           billAmount,
+		SupplierId:       distributerDetails.Id,
+		CustomerId:       distributionInput.CustomerId,
+		TransactionDate:  distributionInput.TransactionDate,
+		ManufacturerId:   manufacturerId,
+		ProductId:        productId,
+		LotNumber:        shippedAsset.LotNumber,
+		TotalParcelUnits: 1,
 	}
 
 	eventDataJSON, err := json.Marshal(event)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	eventErr := ctx.GetStub().SetEvent("Chemist Shipment Alert", eventDataJSON)
+	eventErr := ctx.GetStub().SetEvent(eventName, eventDataJSON)
 	if eventErr != nil {
-		return fmt.Errorf("failed to setEvent Shipment Alert : %v", err.Error())
+		return "", fmt.Errorf("failed to setEvent Shipment Alert : %v", err.Error())
 	}
 
-	return nil
+	return "", nil
 }
 
 /*
@@ -622,123 +806,198 @@ It processes a JSON string holding Shipment details and executes the following a
 2. Generates a receipt for the selling specifics.
 3. Emits an event to mark the transaction.
 
+A packet reported lost or stolen is not shipped; the attempt is recorded instead and the
+"Incident Alert" event is emitted, so that the alert is committed with the transaction, and the rejection
+naming the incident is returned.
+
 @param ctx: TransactionContextInterface for the smart contract.
 @param distributionInputString: JSON string containing Customer Selling details.
+The patient identifier and its salt are passed through the transient map under the key "patient",
+and only the salted hash of it is recorded as the customer on the public ledger.
 
+@returns string: Returns the JSON-encoded rejection when the packet was reported lost or stolen, otherwise empty
 @returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
 */
-func (s *SmartContract) ShipToCustomer(ctx contractapi.TransactionContextInterface, distributionInputString string) error {
+func (s *SmartContract) ShipToCustomer(ctx contractapi.TransactionContextInterface, distributionInputString string) (string, error) {
 	distributionInput := struct {
-		CustomerId      string `json:"customerId"`
-		PacketId        string `json:"packetId"`
-		TransactionDate int64  `json:"transactionDate"`
+		PacketId           string `json:"packetId"`
+		TransactionDate    int64  `json:"transactionDate"`
+		FefoOverrideReason string `json:"fefoOverrideReason"`
 	}{}
 
 	/* Unmarshals the input JSON string into the unnamed struct */
 	err := json.Unmarshal([]byte(distributionInputString), &distributionInput)
 	if err != nil {
-		return fmt.Errorf("Failed to unmarshal the input string for distribution: %v", err.Error())
+		return "", fmt.Errorf("Failed to unmarshal the input string for distribution: %v", err.Error())
 	}
 	fmt.Println("Input String:", distributionInput)
 
 	/* Validates the logged-in entity to ensure it is active */
 	chemistDetails, _, err := getProfileDetails(ctx)
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	/* Raises an alert instead of selling a packet reported lost or stolen */
+	rejection, err := raiseIncidentAlert(ctx, distributionInput.PacketId, chemistDetails.Id, "ShipToCustomer")
+	if err != nil {
+		return "", err
+	}
+	if rejection != "" {
+		return rejection, nil
+	}
+
+	/* Replaces the patient identifier with its salted hash, keeping the clear value in the patient collection */
+	customerRef, err := putTransientPatient(ctx, chemistDetails.Id)
+	if err != nil {
+		return "", err
 	}
 
-	/* Updates Owner from Chemist to customer for an asset */
-	queryString := fmt.Sprintf(`{"selector":{"owner":"%s","id":"%s"}}`, chemistDetails.Id, distributionInput.PacketId)
+	/* Updates Owner from Chemist to customer for an unopened asset held in the chemist inventory */
+	queryString := fmt.Sprintf(`{"selector":{"owner":"%s","id":"%s","status":"%s"}}`,
+		chemistDetails.Id, distributionInput.PacketId, vaccinechainhelper.Statuses.ChemistInventoryReceived)
 	fmt.Println("queryString:", queryString)
 
-	productId, manufacturerId, _, err := getQueryResultForAssetUpdateQueryString(ctx,
+	shippedAsset, _, err := getQueryResultForAssetUpdateQueryString(ctx,
 		queryString,
-		distributionInput.CustomerId,
-		vaccinechainhelper.Statuses.SoldToCustomer)
+		customerRef,
+		vaccinechainhelper.Statuses.SoldToCustomer,
+		"")
 	if err != nil {
-		return err
+		return "", err
 	}
+	productId, manufacturerId := shippedAsset.ProductId, shippedAsset.ManufacturerId
 
-	/* Checks if the product, created by the manufacturer, exists */
-	var productDetails Product
-	tempProductId := productId + manufacturerId
-	productBytes, err := vaccinechainhelper.IsActive(ctx, tempProductId, vaccinechainhelper.ITEM)
+	/* Checks that the batch has not been put on hold or rejected since its release */
+	err = checkBatchNotHeld(ctx, manufacturerId, shippedAsset.BatchId)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	err = json.Unmarshal(productBytes, &productDetails)
+	/* Enforces first-expiry-first-out dispatch when the policy of the chemist requires it */
+	err = checkFefo(ctx, chemistDetails, shippedAsset, distributionInput.FefoOverrideReason)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the product, created by the manufacturer, exists and is active */
+	productDetails, err := getActiveProduct(ctx, productId, manufacturerId)
+	if err != nil {
+		return "", err
+	}
 	fmt.Println("productDetails:", productDetails)
 
-	/* Creates a Receipt for the sell transaction */
-	billAmount := productDetails.Price * productDetails.PacketCapacity
+	/* Creates a Receipt for the sell transaction, with the pricing kept private to the chemist */
+	pricing, err := getTransientPricing(ctx, false)
+	if err != nil {
+		return "", err
+	}
+	pricing.PerUnitSellingPrice = productDetails.Price
+	pricing.BillAmount = productDetails.Price * productDetails.PacketCapacity
 	err = createReceipt(
 		ctx,
 		distributionInput.PacketId,
 		chemistDetails.Id,
-		distributionInput.CustomerId,
+		customerRef,
 		productId,
 		distributionInput.TransactionDate,
-		billAmount)
+		pricing,
+		"",
+		shippedAsset.LocationId,
+		"")
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	/* Emits an event for the sell transaction */
 	event := struct {
-		SupplierId          string
-		CustomerId          string
-		TransactionDate     int64
-		PerUnitSellingPrice int16
-		ManufacturerId      string
-		ProductId           string
-		TotalParcelUnits    int16
-		TotalBill           int16
+		SupplierId       string
+		CustomerId       string
+		TransactionDate  int64
+		ManufacturerId   string
+		ProductId        string
+		LotNumber        string
+		TotalParcelUnits int16
 	}{
-		SupplierId:          chemistDetails.Id,
-		CustomerId:          distributionInput.CustomerId,
-		TransactionDate:     distributionInput.TransactionDate,
-		PerUnitSellingPrice: productDetails.Price,
-		ManufacturerId:      manufacturerId,
-		ProductId:           productId,
-		TotalParcelUnits:    1,
-		TotalBill:           billAmount,
+		SupplierId:       chemistDetails.Id,
+		CustomerId:       customerRef,
+		TransactionDate:  distributionInput.TransactionDate,
+		ManufacturerId:   manufacturerId,
+		ProductId:        productId,
+		LotNumber:        shippedAsset.LotNumber,
+		TotalParcelUnits: 1,
 	}
 
 	eventDataJSON, err := json.Marshal(event)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	eventErr := ctx.GetStub().SetEvent("Customer Selling Alert", eventDataJSON)
 	if eventErr != nil {
-		return fmt.Errorf("failed to setEvent Shipment Alert: %v", err.Error())
+		return "", fmt.Errorf("failed to setEvent Shipment Alert: %v", err.Error())
 	}
 
+	return "", nil
+}
+
+/*
+checkEntityMspId checks that the MSP ID of an entity is recorded, so that the pricing of its receipts can be written
+to the private collection of its organization.
+*/
+func checkEntityMspId(entity Entity) error {
+	if entity.MspId == "" {
+		return fmt.Errorf("MSP ID of %v is not recorded, it must be set with UpdateEntityMspId before shipping to it", entity.Id)
+	}
 	return nil
 }
 
 /*
 createReceipt function creates a receipt for a transaction.
+The pricing is written to the private pricing collections of the supplier's organization and, when given,
+of the customer's organization, while the receipt on the public ledger only carries its hash. The customer MSP ID is
+only left empty for sales to patients, which have no organization.
 @returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
 */
-func createReceipt(ctx contractapi.TransactionContextInterface, bundleId string, supplierId string, customerId string, productId string, transactionDate int64, billAmount int16) error {
+func createReceipt(ctx contractapi.TransactionContextInterface, bundleId string, supplierId string, customerId string, productId string, transactionDate int64, pricing ReceiptPricing, customerMspId string, originLocationId string, destLocationId string) error {
 	txID := ctx.GetStub().GetTxID()
+	supplierMspId, err := getCallerMspId(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Inserts pricing details into the private collections */
+	pricing.Id = txID
+	pricing.DocType = RECEIPT_PRICING
+	mspIds := []string{supplierMspId}
+	if customerMspId != "" {
+		mspIds = append(mspIds, customerMspId)
+	}
+	pricingHash, err := putReceiptPricing(ctx, pricing, mspIds...)
+	if err != nil {
+		return err
+	}
+
 	receipt := Receipt{
-		Id:              txID,
-		BundleId:        bundleId,
-		DocType:         vaccinechainhelper.RECEIPT,
-		SupplierId:      supplierId,
-		CustomerId:      customerId,
-		ProductId:       productId,
-		TransactionDate: transactionDate,
-		BillAmount:      billAmount,
+		Id:               txID,
+		BundleId:         bundleId,
+		DocType:          vaccinechainhelper.RECEIPT,
+		SupplierId:       supplierId,
+		CustomerId:       customerId,
+		ProductId:        productId,
+		TransactionDate:  transactionDate,
+		PricingHash:      pricingHash,
+		SupplierMspId:    supplierMspId,
+		CustomerMspId:    customerMspId,
+		Status:           ReceiptStatuses.Active,
+		OriginLocationId: originLocationId,
+		DestLocationId:   destLocationId,
 	}
 
 	/* Inserts receipt details into the ledger */
-	err := insertData(ctx, receipt, txID, "")
+	err = insertData(ctx, receipt, txID, "")
 	if err != nil {
-		return nil
+		return err
 	}
 	return nil
 }
@@ -788,8 +1047,9 @@ func (s *SmartContract) GetAssetByEntity(ctx contractapi.TransactionContextInter
 		return "", err
 	}
 
-	/* Retrieves the list of assets held by the entity */
-	queryString := fmt.Sprintf(`{"selector":{"owner":"%s","docType":"ASSET"}}`, entityDetails.Id)
+	/* Retrieves the list of assets held by the entity, leaving out destroyed and written-off stock */
+	queryString := fmt.Sprintf(`{"selector":{"owner":"%s","docType":"ASSET","status":{"$nin":["%s","%s"]}}}`,
+		entityDetails.Id, AssetStatuses.Destroyed, AssetStatuses.WrittenOff)
 	fmt.Println("queryString: ", queryString)
 
 	currentAssetsByEntity, err := getQueryResultForQueryString(ctx, queryString)
@@ -824,19 +1084,20 @@ func (s *SmartContract) ViewProfileDetails(ctx contractapi.TransactionContextInt
 }
 
 /*
-TrackPacket retrieves the entire history of an asset from Manufacturer to Customer.
+TrackPacket retrieves the entire history of an asset from Manufacturer to Customer: the legal ownership timeline
+from the asset's own history, and the physical custody timeline recorded by carriers on shipment documents.
 
 @param ctx: TransactionContextInterface for the smart contract
 @param key: Key for the asset
 
-@returns []History : Returns an array of JSON objects representing the asset's history
+@returns PacketTrack : Returns the ownership and custody timelines of the asset
 @returns error: Returns an error if any validation fails or if there is an issue while interacting with the ledger.
 */
-func (s *SmartContract) TrackPacket(ctx contractapi.TransactionContextInterface, key string) ([]History, error) {
+func (s *SmartContract) TrackPacket(ctx contractapi.TransactionContextInterface, key string) (PacketTrack, error) {
 
 	resultsIterator, err := ctx.GetStub().GetHistoryForKey(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get history for key %s: %v", key, err.Error())
+		return PacketTrack{}, fmt.Errorf("failed to get history for key %s: %v", key, err.Error())
 	}
 
 	defer resultsIterator.Close()
@@ -848,26 +1109,27 @@ func (s *SmartContract) TrackPacket(ctx contractapi.TransactionContextInterface,
 		fmt.Println("Inside Result Iterator")
 		response, err := resultsIterator.Next()
 		if err != nil {
-			return nil, fmt.Errorf("error fetching history: %v", err.Error())
+			return PacketTrack{}, fmt.Errorf("error fetching history: %v", err.Error())
 		}
 		var record Asset
 		if !response.IsDelete {
 			if err := json.Unmarshal(response.Value, &record); err != nil {
-				return nil, fmt.Errorf("error unmarshaling JSON: %v", err)
+				return PacketTrack{}, fmt.Errorf("error unmarshaling JSON: %v", err)
 			}
 		}
 
 		if record.DocType != vaccinechainhelper.ASSET && !checkStatus {
-			return nil, fmt.Errorf("this tracking ID does not belong to asset: %s", key)
+			return PacketTrack{}, fmt.Errorf("this tracking ID does not belong to asset: %s", key)
 		}
 		checkStatus = true
 
 		timestamp, err := ptypes.Timestamp(response.Timestamp)
 		if err != nil {
-			return nil, err
+			return PacketTrack{}, err
 		}
 
 		history.Id = record.Id
+		history.LotNumber = record.LotNumber
 		history.Owner = record.Owner
 		history.Status = record.Status
 		history.TxId = response.TxId
@@ -877,12 +1139,20 @@ func (s *SmartContract) TrackPacket(ctx contractapi.TransactionContextInterface,
 		histories = append(histories, history)
 	}
 	fmt.Println("*********************")
-	return histories, nil
+
+	/* Retrieves the custody events recorded by carriers for the asset */
+	custody, err := getCustodyTimeline(ctx, key)
+	if err != nil {
+		return PacketTrack{}, err
+	}
+
+	return PacketTrack{Ownership: histories, Custody: custody}, nil
 }
 
 /*
-ViewReceipt retrieves the entire details of a specific receipt transaction.
+ViewReceipt retrieves the entire details of a specific receipt transaction, along with its amendment chain.
 This function can only be called by the Supplier and Vendor involved in this transaction.
+The private pricing is merged into the receipt when it is available to the caller's organization.
 
 @param ctx: TransactionContextInterface for the smart contract
 @param receiptId: ReceiptID for the transaction
@@ -919,278 +1189,98 @@ func (s *SmartContract) ViewReceipt(ctx contractapi.TransactionContextInterface,
 		return "", fmt.Errorf("You are not authorized to view the receipt")
 	}
 
-	return string(receiptBytes), nil
+	return getReceiptView(ctx, receipt, true)
 }
 
-/*
-ChangeAdminStatus modifies the status of VaccineChainAdmin (Suspend/Unsuspend).
-This function requires Super Admin privileges for execution.
-
-@param ctx: TransactionContextInterface for the smart contract
-@param changeStatusInputString: JSON string containing Admin details
-
-@returns error: Returns an error if the transaction encounters issues
-*/
-func (s *SmartContract) ChangeAdminStatus(ctx contractapi.TransactionContextInterface, changeStatusInputString string) error {
-	changeStatusInput := struct {
-		Id      string `json:"id"`
-		DocType string `json:"docType" validate:"required,eq=VACCINE_CHAIN_ADMIN"`
-		Status  bool   `json:"status"`
-	}{}
+func getProfileDetails(ctx contractapi.TransactionContextInterface) (Entity, string, error) {
 
-	/* Unmarshals the input JSON string into the unnamed struct */
-	err := json.Unmarshal([]byte(changeStatusInputString), &changeStatusInput)
+	//getting logged-in entity username
+	entityIdentity, err := vaccinechainhelper.GetUserIdentityName(ctx)
+	fmt.Println("entityIdentity :", entityIdentity)
 	if err != nil {
-		return fmt.Errorf("Failed to unmarshal the input string for status change: %v", err.Error())
+		return Entity{}, "", err
 	}
-	fmt.Println("Input String:", changeStatusInput)
 
-	/* Validates input parameters */
-	err = validateInputParams(changeStatusInput)
+	//getting logged-in entity attributes
+	attributes, err := vaccinechainhelper.GetAllCertificateAttributes(ctx, []string{"userRole"})
 	if err != nil {
-		return err
-	}
-
-	/* Verifies if the logged-in entity is authorized to change the status */
-	superAdminIdentity, err := vaccinechainhelper.GetUserIdentityName(ctx)
-	fmt.Println("superAdminIdentity:", superAdminIdentity)
-	if !(superAdminIdentity == vaccinechainhelper.SUPER_ADMIN && changeStatusInput.DocType == vaccinechainhelper.VACCINE_CHAIN_ADMIN) {
-		return fmt.Errorf("Permission denied: Only the super admin can call this function")
+		return Entity{}, "", err
 	}
+	fmt.Println("userRole for entityIdentity :", attributes["userRole"])
 
-	/* Verifies if the ID for which the status needs to be updated exists or not */
-	objectBytes, err := vaccinechainhelper.IsExist(ctx, changeStatusInput.Id, changeStatusInput.DocType)
+	//validating User Id
+	entityDetailer, err := vaccinechainhelper.IsActive(ctx, entityIdentity, attributes["userRole"])
 	if err != nil {
-		return err
+		return Entity{}, "", err
 	}
-	if objectBytes == nil {
-		return fmt.Errorf("Record for user %v does not exist", changeStatusInput.Id)
+	if entityDetailer == nil {
+		return Entity{}, "", fmt.Errorf("Record for %v user does not exist", entityIdentity)
 	}
 
-	var entity Entity
-	err = json.Unmarshal(objectBytes, &entity)
-	fmt.Println("entity:", entity)
-
-	/* Verifies the status of the ID for which the status needs to be updated */
-	status, err := vaccinechainhelper.SuspendStatus(ctx, objectBytes)
+	var entityDetails Entity
+	err = json.Unmarshal(entityDetailer, &entityDetails)
 	if err != nil {
-		return err
-	}
-
-	if status == changeStatusInput.Status {
-		return fmt.Errorf("Status is already %v", status)
+		return Entity{}, "", fmt.Errorf("Failed to convert Detailer to Entity type")
 	}
+	fmt.Println("entityDetails:", entityDetails)
 
-	/* Updates the new status to the ledger */
-	entity.Suspended = changeStatusInput.Status
-	err = insertData(ctx, entity, changeStatusInput.Id, changeStatusInput.DocType)
+	//an expired licence makes the entity inactive, the same way a suspension does
+	err = checkLicenseValid(ctx, entityDetails)
 	if err != nil {
-		return nil
+		return Entity{}, "", err
 	}
 
-	return nil
+	fmt.Println("********** End of getProfileDetails Function ******************")
+	return entityDetails, attributes["userRole"], nil
 }
 
-/*
-ChangeEntityStatus modifies the status of Entity (Suspend/Unsuspend).
-This function requires Admin privileges for execution.
-
-@param ctx: TransactionContextInterface for the smart contract
-@param changeStatusInputString: JSON string containing Admin details
-
-@returns error: Returns an error if the transaction encounters issues
-*/
-func (s *SmartContract) ChangeEntityStatus(ctx contractapi.TransactionContextInterface, changeStatusInputString string) error {
-	changeStatusInput := struct {
-		Id      string `json:"id"`
-		DocType string `json:"docType" validate:"required,oneof=MANUFACTURER DISTRIBUTER CHEMIST"`
-		Status  bool   `json:"status"`
-	}{}
-
-	/* Unmarshals the input JSON string into the unnamed struct */
-	err := json.Unmarshal([]byte(changeStatusInputString), &changeStatusInput)
-	if err != nil {
-		return fmt.Errorf("Failed to unmarshal input string for change status: %v", err.Error())
-	}
-	fmt.Println("Input String :", changeStatusInput)
-
-	/* Validates input parameters */
-	err = validateInputParams(changeStatusInput)
-	if err != nil {
-		return err
-	}
-
-	/* Validates logged-in entity whether it is active or not */
-	_, role, err := getProfileDetails(ctx)
-	if err != nil {
-		return err
-	}
-
-	/* Verifies if the logged-in entity is authorized to change the status */
-	if !(role == vaccinechainhelper.VACCINE_CHAIN_ADMIN &&
-		((changeStatusInput.DocType == vaccinechainhelper.MANUFACTURER) ||
-			(changeStatusInput.DocType == vaccinechainhelper.DISTRIBUTER) ||
-			(changeStatusInput.DocType == vaccinechainhelper.CHEMIST))) {
-		return fmt.Errorf("permission denied: only admin can call this function")
-	}
-
-	/* Verifies if the ID for which the status needs to be updated exists or not */
-	objectBytes, err := vaccinechainhelper.IsExist(ctx, changeStatusInput.Id, changeStatusInput.DocType)
-	if err != nil {
-		return err
-	}
-	if objectBytes == nil {
-		return fmt.Errorf("Record for %v user does not exist", changeStatusInput.Id)
-	}
-
-	var entity Entity
-	err = json.Unmarshal(objectBytes, &entity)
-	fmt.Println("entity :", entity)
-
-	/* Verifies the status of the ID for which the status needs to be updated */
-	status, err := vaccinechainhelper.SuspendStatus(ctx, objectBytes)
-	if err != nil {
-		return err
-	}
-
-	if status == changeStatusInput.Status {
-		return fmt.Errorf("Status is already %v", status)
-	}
-
-	/* Updates the new status to the ledger */
-	entity.Suspended = changeStatusInput.Status
-	err = insertData(ctx, entity, changeStatusInput.Id, changeStatusInput.DocType)
-	if err != nil {
-		return nil
-	}
-
-	return nil
-
+/* isDispensingRole reports whether the role holds stock at the point of vaccination */
+func isDispensingRole(role string) bool {
+	return role == vaccinechainhelper.CHEMIST || role == HOSPITAL || role == CLINIC
 }
 
 /*
-ChangeStatus modifies the status of Entity (Suspend/Unsuspend).
-This function requires Admin privileges for execution.
-
-@param ctx: TransactionContextInterface for the smart contract
-@param changeStatusInputString: JSON string containing Entity details
-
-@returns error: Returns an error if the transaction encounters issues
+getActiveEntity looks up an active entity registered under any of the given types
+and returns it along with the type it is registered under.
 */
-func (s *SmartContract) ChangeStatus(ctx contractapi.TransactionContextInterface, changeStatusInputString string) error {
-	changeStatusInput := struct {
-		Id      string `json:"id"`
-		DocType string `json:"docType" validate:"required,oneof=VACCINE_CHAIN_ADMIN MANUFACTURER DISTRIBUTER CHEMIST"`
-		Status  bool   `json:"status"`
-	}{}
-
-	/* Unmarshals the input JSON string into the unnamed struct */
-	err := json.Unmarshal([]byte(changeStatusInputString), &changeStatusInput)
-	if err != nil {
-		return fmt.Errorf("Failed to unmarshal input string for change status: %v", err.Error())
-	}
-	fmt.Println("Input String :", changeStatusInput)
-
-	/* Validates input parameters */
-	err = validateInputParams(changeStatusInput)
-	if err != nil {
-		return err
-	}
-
-	if changeStatusInput.DocType == vaccinechainhelper.VACCINE_CHAIN_ADMIN {
-		/* Verifies if the logged-in entity is authorized to change the status */
-		superAdminIdentity, err := vaccinechainhelper.GetUserIdentityName(ctx)
+func getActiveEntity(ctx contractapi.TransactionContextInterface, entityId string, docTypes ...string) (Entity, string, error) {
+	for _, docType := range docTypes {
+		entityBytes, err := vaccinechainhelper.IsExist(ctx, entityId, docType)
 		if err != nil {
-			return err
+			return Entity{}, "", err
 		}
-		fmt.Println("superAdminIdentity:", superAdminIdentity)
-		if !(superAdminIdentity == vaccinechainhelper.SUPER_ADMIN && changeStatusInput.DocType == vaccinechainhelper.VACCINE_CHAIN_ADMIN) {
-			return fmt.Errorf("Permission denied: Only the super admin can call this function")
+		if entityBytes == nil {
+			continue
 		}
-	} else {
-		/* Validates logged-in entity whether it is active or not */
-		_, role, err := getProfileDetails(ctx)
+
+		entityBytes, err = vaccinechainhelper.IsActive(ctx, entityId, docType)
 		if err != nil {
-			return err
+			return Entity{}, "", err
 		}
-
-		/* Verifies if the logged-in entity is authorized to change the status */
-		if !(role == vaccinechainhelper.VACCINE_CHAIN_ADMIN &&
-			((changeStatusInput.DocType == vaccinechainhelper.MANUFACTURER) ||
-				(changeStatusInput.DocType == vaccinechainhelper.DISTRIBUTER) ||
-				(changeStatusInput.DocType == vaccinechainhelper.CHEMIST))) {
-			return fmt.Errorf("permission denied: only admin can call this function")
+		if entityBytes == nil {
+			return Entity{}, "", fmt.Errorf("%v %v is not active", docType, entityId)
 		}
-	}
 
-	/* Verifies if the ID for which the status needs to be updated exists or not */
-	objectBytes, err := vaccinechainhelper.IsExist(ctx, changeStatusInput.Id, changeStatusInput.DocType)
-	if err != nil {
-		return err
-	}
-	if objectBytes == nil {
-		return fmt.Errorf("Record for %v user does not exist", changeStatusInput.Id)
-	}
-
-	var entity Entity
-	err = json.Unmarshal(objectBytes, &entity)
-	fmt.Println("entity :", entity)
-
-	/* Verifies the status of the ID for which the status needs to be updated */
-	status, err := vaccinechainhelper.SuspendStatus(ctx, objectBytes)
-	if err != nil {
-		return err
-	}
-
-	if status == changeStatusInput.Status {
-		return fmt.Errorf("Status is already %v", status)
-	}
-
-	/* Updates the new status to the ledger */
-	entity.Suspended = changeStatusInput.Status
-	err = insertData(ctx, entity, changeStatusInput.Id, changeStatusInput.DocType)
-	if err != nil {
-		return nil
+		var entity Entity
+		err = json.Unmarshal(entityBytes, &entity)
+		if err != nil {
+			return Entity{}, "", fmt.Errorf("Failed to convert entity details: %v", err.Error())
+		}
+		err = checkLicenseValid(ctx, entity)
+		if err != nil {
+			return Entity{}, "", err
+		}
+		return entity, docType, nil
 	}
-
-	return nil
-
+	return Entity{}, "", fmt.Errorf("Record does not exist with ID: %v", entityId)
 }
 
-func getProfileDetails(ctx contractapi.TransactionContextInterface) (Entity, string, error) {
-
-	//getting logged-in entity username
-	entityIdentity, err := vaccinechainhelper.GetUserIdentityName(ctx)
-	fmt.Println("entityIdentity :", entityIdentity)
-	if err != nil {
-		return Entity{}, "", err
-	}
-
-	//getting logged-in entity attributes
-	attributes, err := vaccinechainhelper.GetAllCertificateAttributes(ctx, []string{"userRole"})
-	if err != nil {
-		return Entity{}, "", err
-	}
-	fmt.Println("userRole for entityIdentity :", attributes["userRole"])
-
-	//validating User Id
-	entityDetailer, err := vaccinechainhelper.IsActive(ctx, entityIdentity, attributes["userRole"])
-	if err != nil {
-		return Entity{}, "", err
-	}
-	if entityDetailer == nil {
-		return Entity{}, "", fmt.Errorf("Record for %v user does not exist", entityIdentity)
-	}
-
-	var entityDetails Entity
-	err = json.Unmarshal(entityDetailer, &entityDetails)
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
 	if err != nil {
-		return Entity{}, "", fmt.Errorf("Failed to convert Detailer to Entity type")
+		return time.Time{}, fmt.Errorf("Failed to get transaction timestamp: %v", err.Error())
 	}
-	fmt.Println("entityDetails:", entityDetails)
-
-	fmt.Println("********** End of getProfileDetails Function ******************")
-	return entityDetails, attributes["userRole"], nil
+	return ptypes.Timestamp(txTimestamp)
 }
 
 func getQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) (string, error) {
@@ -1233,54 +1323,144 @@ func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorI
 
 }
 
-func getQueryResultForAssetUpdateQueryString(ctx contractapi.TransactionContextInterface, queryString string, newOwner string, newStatus string) (string, string, int16, error) {
+/*
+getQueryResultForAssetUpdateQueryString moves the assets matching the query string to their new owner, status and
+location. Every asset must be kept at the same location, which is the origin recorded on the receipt. It returns
+the last shipped asset as it was before the move, so that callers can read where it was shipped from, along with the
+number of assets shipped.
+*/
+func getQueryResultForAssetUpdateQueryString(ctx contractapi.TransactionContextInterface, queryString string, newOwner string, newStatus string, newLocationId string) (Asset, int16, error) {
 
 	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
 	if err != nil {
-		return "", "", 0, err
+		return Asset{}, 0, err
 	}
 	defer resultsIterator.Close()
 
 	// Check if there are no records in the iterator
 	if !resultsIterator.HasNext() {
 		fmt.Println("No Records found for Transaction")
-		return "", "", 0, fmt.Errorf("No Records found for Transaction")
+		return Asset{}, 0, fmt.Errorf("No Records found for Transaction")
 	}
 
-	var productId, manufacturerId string
+	var shippedAsset Asset
 	var totalBundle int16 = 0
 	for resultsIterator.HasNext() {
 		responseRange, err := resultsIterator.Next()
 		if err != nil {
-			return "", "", 0, err
+			return Asset{}, 0, err
 		}
 
 		var asset Asset
 		assetBytes, err := ctx.GetStub().GetState(responseRange.Key)
 		if err != nil {
-			return "", "", 0, fmt.Errorf("failed to get asset %s: %v", responseRange.Key, err)
+			return Asset{}, 0, fmt.Errorf("failed to get asset %s: %v", responseRange.Key, err)
 		}
 		err = json.Unmarshal(assetBytes, &asset)
 		if err != nil {
-			return "", "", 0, err
+			return Asset{}, 0, err
+		}
+		if blockedAssetStatuses[asset.Status] {
+			return Asset{}, 0, fmt.Errorf("Asset %v is %v and cannot be shipped", asset.Id, asset.Status)
+		}
+		if totalBundle > 0 && asset.LocationId != shippedAsset.LocationId {
+			return Asset{}, 0, fmt.Errorf("Assets %v and %v are kept at different locations and cannot be shipped together",
+				shippedAsset.Id, asset.Id)
 		}
 
+		shippedAsset = asset
 		asset.Owner = newOwner
 		asset.Status = newStatus
+		asset.LocationId = newLocationId
 		assetBytes, err = json.Marshal(asset)
 		if err != nil {
-			return "", "", 0, err
+			return Asset{}, 0, err
 		}
 		err = ctx.GetStub().PutState(responseRange.Key, assetBytes)
 		if err != nil {
-			return "", "", 0, fmt.Errorf("Shipment failed for asset %s: %v", asset.Id, err)
+			return Asset{}, 0, fmt.Errorf("Shipment failed for asset %s: %v", asset.Id, err)
 		}
-		productId = asset.ProductId
-		manufacturerId = asset.ManufacturerId
 		totalBundle++
 	}
 
-	return productId, manufacturerId, totalBundle, nil
+	return shippedAsset, totalBundle, nil
+}
+
+func getProduct(ctx contractapi.TransactionContextInterface, productId string, manufacturerId string) (Product, error) {
+	productBytes, err := vaccinechainhelper.IsExist(ctx, productId+manufacturerId, vaccinechainhelper.ITEM)
+	if err != nil {
+		return Product{}, err
+	}
+	if productBytes == nil {
+		return Product{}, fmt.Errorf("Record does not exist with ID: %v", productId)
+	}
+
+	var productDetails Product
+	err = json.Unmarshal(productBytes, &productDetails)
+	if err != nil {
+		return Product{}, err
+	}
+	return productDetails, nil
+}
+
+/* getActiveProduct returns the details of a product, refusing one that has been suspended */
+func getActiveProduct(ctx contractapi.TransactionContextInterface, productId string, manufacturerId string) (Product, error) {
+	productBytes, err := vaccinechainhelper.IsActive(ctx, productId+manufacturerId, vaccinechainhelper.ITEM)
+	if err != nil {
+		return Product{}, err
+	}
+	if productBytes == nil {
+		return Product{}, fmt.Errorf("Record does not exist with ID: %v", productId)
+	}
+
+	var productDetails Product
+	err = json.Unmarshal(productBytes, &productDetails)
+	if err != nil {
+		return Product{}, err
+	}
+	return productDetails, nil
+}
+
+func getAsset(ctx contractapi.TransactionContextInterface, assetId string) (Asset, error) {
+	assetBytes, err := ctx.GetStub().GetState(assetId)
+	if err != nil {
+		return Asset{}, fmt.Errorf("failed to get asset %s: %v", assetId, err)
+	}
+	if assetBytes == nil {
+		return Asset{}, fmt.Errorf("Asset does not exist for ID: %s", assetId)
+	}
+
+	var asset Asset
+	err = json.Unmarshal(assetBytes, &asset)
+	if err != nil {
+		return Asset{}, err
+	}
+	if asset.DocType != vaccinechainhelper.ASSET {
+		return Asset{}, fmt.Errorf("ID %s does not belong to an asset", assetId)
+	}
+	return asset, nil
+}
+
+/* getCartonAssetIds returns the IDs of the packets of a carton */
+func getCartonAssetIds(ctx contractapi.TransactionContextInterface, cartonId string) ([]string, error) {
+	queryString := fmt.Sprintf(`{"selector":{"cartonId":"%s","docType":"%s"}}`, cartonId, vaccinechainhelper.ASSET)
+	fmt.Println("queryString:", queryString)
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var assetIds []string
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		assetIds = append(assetIds, queryResult.Key)
+	}
+	return assetIds, nil
 }
 
 func insertData(ctx contractapi.TransactionContextInterface, entity interface{}, id string, docType string) error {
@@ -1315,6 +1495,7 @@ func validateInputParams(object interface{}) error {
 	validate := validator.New()
 	validate.RegisterValidation("validName", validateName)
 	validate.RegisterValidation("validNumber", validateNumber)
+	validate.RegisterValidation("validLotNumber", validateLotNumber)
 	validate.RegisterValidation("expiryGreaterThanManufacturing", expiryGreaterThanManufacturing)
 	err := validate.Struct(object)
 	if err != nil {
@@ -1346,6 +1527,14 @@ func validateNumber(fl validator.FieldLevel) bool {
 	return regex.MatchString(number)
 }
 
+func validateLotNumber(fl validator.FieldLevel) bool {
+	lotNumber := fl.Field().String()
+	// Define a regular expression to allow only letters, numbers, hyphens and slashes
+	regex := regexp.MustCompile("^[A-Za-z0-9/-]+$")
+
+	return regex.MatchString(lotNumber)
+}
+
 func expiryGreaterThanManufacturing(fl validator.FieldLevel) bool {
 	expiry := fl.Field().Int()
 	manufacturing := fl.Parent().FieldByName("ManufacturingDate").Int()
@@ -0,0 +1,306 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Prasenjit43/vaccinechainhelper"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+type WastageLine struct {
+	ProductId      string `json:"productId"`
+	ManufacturerId string `json:"manufacturerId"`
+	VialsOpened    int    `json:"vialsOpened"`
+	DosesConsumed  int64  `json:"dosesConsumed"`
+	DosesWasted    int64  `json:"dosesWasted"`
+	DosesToDiscard int64  `json:"dosesToDiscard"`
+	WastagePercent int64  `json:"wastagePercent"`
+}
+
+type WastageReport struct {
+	ChemistId string        `json:"chemistId"`
+	AsOf      int64         `json:"asOf"`
+	Lines     []WastageLine `json:"lines"`
+}
+
+/*
+ConsumeDose records the use of doses from a multi-dose vial held by the Chemist, Hospital or Clinic. The first use opens the vial,
+after which it may only be used until the discard window of the product has elapsed. Doses are consumed as of the transaction time.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param consumeInputString: JSON string with the vial and the doses consumed
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) ConsumeDose(ctx contractapi.TransactionContextInterface, consumeInputString string) error {
+	consumeInput := struct {
+		PacketId string `json:"packetId" validate:"required"`
+		Doses    int16  `json:"doses" validate:"required,gt=0"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(consumeInputString), &consumeInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for dose consumption: %v", err.Error())
+	}
+	fmt.Println("Input String:", consumeInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(consumeInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	chemistDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is that of a chemist, hospital or clinic */
+	if !isDispensingRole(role) {
+		return fmt.Errorf("Only Chemists, Hospitals and Clinics are allowed to consume doses")
+	}
+
+	asset, err := getAsset(ctx, consumeInput.PacketId)
+	if err != nil {
+		return err
+	}
+	if asset.Owner != chemistDetails.Id {
+		return fmt.Errorf("Packet %v is not held by %v", asset.Id, chemistDetails.Id)
+	}
+
+	/* Checks that the batch has not been put on hold or rejected since its release */
+	err = checkBatchNotHeld(ctx, asset.ManufacturerId, asset.BatchId)
+	if err != nil {
+		return err
+	}
+
+	/* Deducts the doses from the vial */
+	err = consumeVialDoses(ctx, &asset, consumeInput.Doses)
+	if err != nil {
+		return err
+	}
+
+	err = insertData(ctx, asset, asset.Id, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Consume Dose Function ******************")
+	return nil
+}
+
+/*
+DiscardOpenVial discards an opened multi-dose vial held by the Chemist, Hospital or Clinic and records its remaining doses
+as wasted, along with the date it was discarded.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param discardInputString: JSON string with the vial and the discard date
+
+@returns error: Returns an error if any validation fails or if there's an issue interacting with the ledger.
+*/
+func (s *SmartContract) DiscardOpenVial(ctx contractapi.TransactionContextInterface, discardInputString string) error {
+	discardInput := struct {
+		PacketId    string `json:"packetId" validate:"required"`
+		DiscardDate int64  `json:"discardDate" validate:"required"`
+	}{}
+
+	/* Unmarshals the input JSON string into the unnamed struct */
+	err := json.Unmarshal([]byte(discardInputString), &discardInput)
+	if err != nil {
+		return fmt.Errorf("Failed to unmarshal the input string for vial discard: %v", err.Error())
+	}
+	fmt.Println("Input String:", discardInput)
+
+	/* Validates input parameters */
+	err = validateInputParams(discardInput)
+	if err != nil {
+		return err
+	}
+
+	/* Validates the logged-in entity to ensure it is active */
+	chemistDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return err
+	}
+
+	/* Checks if the user role is that of a chemist, hospital or clinic */
+	if !isDispensingRole(role) {
+		return fmt.Errorf("Only Chemists, Hospitals and Clinics are allowed to discard vials")
+	}
+
+	asset, err := getAsset(ctx, discardInput.PacketId)
+	if err != nil {
+		return err
+	}
+	if asset.Owner != chemistDetails.Id {
+		return fmt.Errorf("Packet %v is not held by %v", asset.Id, chemistDetails.Id)
+	}
+	if asset.Status != AssetStatuses.VialOpened {
+		return fmt.Errorf("Packet %v is not an opened vial", asset.Id)
+	}
+	if discardInput.DiscardDate < asset.OpenedDate {
+		return fmt.Errorf("Discard date cannot be earlier than the opening of vial %v on %v", asset.Id, asset.OpenedDate)
+	}
+
+	/* Records the remaining doses as wasted */
+	asset.DosesWasted += asset.DosesRemaining
+	asset.DosesRemaining = 0
+	asset.DiscardedDate = discardInput.DiscardDate
+	asset.Status = AssetStatuses.VialDiscarded
+	err = insertData(ctx, asset, asset.Id, "")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("********** End of Discard Open Vial Function ******************")
+	return nil
+}
+
+/*
+GetWastageReport reports the open-vial wastage of a chemist, hospital or clinic per product. They can only report on themselves,
+while the Vaccine Chain Admin and the Regulator can report on any chemist. Doses left in opened vials whose discard
+window has elapsed but which have not been discarded yet are reported separately.
+
+@param ctx: TransactionContextInterface for the smart contract
+@param chemistId: ID of the chemist, or empty for the logged-in chemist
+
+@returns string: Returns the JSON-encoded wastage report
+@returns error: Returns an error if any validation fails or if there's an issue while interacting with the ledger.
+*/
+func (s *SmartContract) GetWastageReport(ctx contractapi.TransactionContextInterface, chemistId string) (string, error) {
+
+	/* Validates the logged-in entity to ensure it is active */
+	entityDetails, role, err := getProfileDetails(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	/* Checks if the user is allowed to view the report of the chemist */
+	if chemistId == "" {
+		chemistId = entityDetails.Id
+	}
+	if !(isDispensingRole(role) && chemistId == entityDetails.Id) &&
+		role != vaccinechainhelper.VACCINE_CHAIN_ADMIN && role != REGULATOR {
+		return "", fmt.Errorf("You are not authorized to view the wastage report of %v", chemistId)
+	}
+
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	asOf := timestamp.Unix()
+
+	queryString := fmt.Sprintf(`{"selector":{"owner":"%s","docType":"%s","openedDate":{"$gt":0}}}`, chemistId, vaccinechainhelper.ASSET)
+	fmt.Println("queryString:", queryString)
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(queryString)
+	if err != nil {
+		return "", err
+	}
+	defer resultsIterator.Close()
+
+	lines := make(map[string]*WastageLine)
+	var productKeys []string
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return "", err
+		}
+
+		var asset Asset
+		err = json.Unmarshal(queryResult.Value, &asset)
+		if err != nil {
+			return "", err
+		}
+
+		productKey := asset.ProductId + asset.ManufacturerId
+		line, ok := lines[productKey]
+		if !ok {
+			line = &WastageLine{ProductId: asset.ProductId, ManufacturerId: asset.ManufacturerId}
+			lines[productKey] = line
+			productKeys = append(productKeys, productKey)
+		}
+
+		line.VialsOpened++
+		line.DosesConsumed += int64(asset.DosesPerVial - asset.DosesRemaining - asset.DosesWasted)
+		line.DosesWasted += int64(asset.DosesWasted)
+		if asset.Status == AssetStatuses.VialOpened && asset.DiscardDate != 0 && asOf > asset.DiscardDate {
+			line.DosesToDiscard += int64(asset.DosesRemaining)
+		}
+	}
+
+	report := WastageReport{
+		ChemistId: chemistId,
+		AsOf:      asOf,
+		Lines:     []WastageLine{},
+	}
+	for _, productKey := range productKeys {
+		line := lines[productKey]
+		totalDoses := line.DosesConsumed + line.DosesWasted + line.DosesToDiscard
+		if totalDoses > 0 {
+			line.WastagePercent = (line.DosesWasted + line.DosesToDiscard) * 100 / totalDoses
+		}
+		report.Lines = append(report.Lines, *line)
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return "", err
+	}
+
+	return string(reportJSON), nil
+}
+
+/*
+consumeVialDoses deducts doses from a vial, opening it on first use. The transaction time is used as the consumption date,
+so that the expiry and the discard window cannot be dodged with a backdated input.
+*/
+func consumeVialDoses(ctx contractapi.TransactionContextInterface, asset *Asset, doses int16) error {
+	if asset.Status != vaccinechainhelper.Statuses.ChemistInventoryReceived && asset.Status != AssetStatuses.VialOpened {
+		return fmt.Errorf("Doses cannot be consumed from packet %v in status %v", asset.Id, asset.Status)
+	}
+
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	consumedDate := timestamp.Unix()
+	if consumedDate > asset.ExpiryDate {
+		return fmt.Errorf("Packet %v has expired", asset.Id)
+	}
+
+	/* Opens the vial on first use and starts its discard window */
+	if asset.OpenedDate == 0 {
+		productDetails, err := getProduct(ctx, asset.ProductId, asset.ManufacturerId)
+		if err != nil {
+			return err
+		}
+
+		asset.OpenedDate = consumedDate
+		if productDetails.DiscardHours > 0 {
+			asset.DiscardDate = consumedDate + int64(productDetails.DiscardHours)*3600
+		}
+		asset.Status = AssetStatuses.VialOpened
+	}
+
+	if asset.DiscardDate != 0 && consumedDate > asset.DiscardDate {
+		return fmt.Errorf("Opened vial %v is past its discard window and must be discarded", asset.Id)
+	}
+	if doses > asset.DosesRemaining {
+		return fmt.Errorf("Vial %v only has %v doses remaining", asset.Id, asset.DosesRemaining)
+	}
+
+	asset.DosesRemaining -= doses
+	if asset.DosesRemaining == 0 {
+		asset.Status = AssetStatuses.VialConsumed
+	}
+
+	return nil
+}